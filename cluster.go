@@ -0,0 +1,356 @@
+// Copyright 2025 The Lemma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+)
+
+const (
+	// DefaultTolerance is the default centroid movement below which kmeans stops
+	DefaultTolerance = 1e-6
+	// DefaultMaxIterations is the default maximum number of kmeans iterations
+	DefaultMaxIterations = 100
+)
+
+// distance computes the euclidean distance between two vectors
+func distance(a, b []float64) float64 {
+	sum := 0.0
+	for i, value := range a {
+		diff := value - b[i]
+		sum += diff * diff
+	}
+	return math.Sqrt(sum)
+}
+
+// nearest returns the index of the centroid nearest to the vector
+func nearest(centroids [][]float64, a []float64) int {
+	index, min := 0, math.MaxFloat64
+	for i, centroid := range centroids {
+		if d := distance(centroid, a); d < min {
+			index, min = i, d
+		}
+	}
+	return index
+}
+
+// KMeans clusters the data set into k clusters using lloyd's algorithm with k-means++ initialization
+// and sets the Cluster field.
+// Iteration stops when no centroid moves more than tol or after maxIter iterations;
+// a non positive tol or maxIter selects the default. The centroids and the number of
+// iterations used are returned.
+func KMeans(iris []Fisher, k int, seed int64, tol float64, maxIter int) ([][]float64, int) {
+	if tol <= 0 {
+		tol = DefaultTolerance
+	}
+	if maxIter <= 0 {
+		maxIter = DefaultMaxIterations
+	}
+	if k > len(iris) {
+		k = len(iris)
+	}
+	if k < 1 {
+		return nil, 0
+	}
+	rng := rand.New(rand.NewSource(seed))
+	width := len(iris[0].Measures)
+	centroids := make([][]float64, 0, k)
+	// k-means++ initialization
+	centroids = append(centroids, append([]float64{}, iris[rng.Intn(len(iris))].Measures...))
+	weights := make([]float64, len(iris))
+	for len(centroids) < k {
+		total := 0.0
+		for i, value := range iris {
+			d := distance(centroids[nearest(centroids, value.Measures)], value.Measures)
+			weights[i] = d * d
+			total += weights[i]
+		}
+		index, sample := len(iris)-1, rng.Float64()*total
+		for i, weight := range weights {
+			sample -= weight
+			if sample < 0 {
+				index = i
+				break
+			}
+		}
+		centroids = append(centroids, append([]float64{}, iris[index].Measures...))
+	}
+	iterations := 0
+	for iterations < maxIter {
+		iterations++
+		for i := range iris {
+			iris[i].Cluster = nearest(centroids, iris[i].Measures)
+		}
+		sums, counts := make([][]float64, k), make([]int, k)
+		for i := range sums {
+			sums[i] = make([]float64, width)
+		}
+		for _, value := range iris {
+			for i, measure := range value.Measures {
+				sums[value.Cluster][i] += measure
+			}
+			counts[value.Cluster]++
+		}
+		moved := 0.0
+		for i := range centroids {
+			if counts[i] == 0 {
+				continue
+			}
+			for ii := range sums[i] {
+				sums[i][ii] /= float64(counts[i])
+			}
+			if d := distance(centroids[i], sums[i]); d > moved {
+				moved = d
+			}
+			centroids[i] = sums[i]
+		}
+		if moved < tol {
+			break
+		}
+	}
+	for i := range iris {
+		iris[i].Cluster = nearest(centroids, iris[i].Measures)
+	}
+	return centroids, iterations
+}
+
+// LabelCentroids computes the mean measures of each label, a multi label record contributes to each of its labels
+func LabelCentroids(iris []Fisher) map[string][]float64 {
+	centroids, counts := make(map[string][]float64), make(map[string]int)
+	for _, value := range iris {
+		for _, label := range value.AllLabels() {
+			centroid, ok := centroids[label]
+			if !ok {
+				centroid = make([]float64, len(value.Measures))
+				centroids[label] = centroid
+			}
+			for i, measure := range value.Measures {
+				centroid[i] += measure
+			}
+			counts[label]++
+		}
+	}
+	for label, centroid := range centroids {
+		for i := range centroid {
+			centroid[i] /= float64(counts[label])
+		}
+	}
+	return centroids
+}
+
+// ClassifyNearestCentroid returns the label of the train centroid nearest to the query
+func ClassifyNearestCentroid(train []Fisher, query []float64) string {
+	centroids := LabelCentroids(train)
+	labels := make([]string, 0, len(centroids))
+	for label := range centroids {
+		labels = append(labels, label)
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+	sort.Strings(labels)
+	scores := make([]float64, len(labels))
+	for i, label := range labels {
+		scores[i] = -distance(centroids[label], query)
+	}
+	return labels[argmax(scores)]
+}
+
+// AugmentWithClusterDistances clusters the data set with kmeans and appends the distance
+// of each record to each of the k centroids to its measures
+func AugmentWithClusterDistances(iris []Fisher, k int) {
+	centroids, _ := KMeans(iris, k, 1, DefaultTolerance, DefaultMaxIterations)
+	for i := range iris {
+		measures := iris[i].Measures
+		augmented := make([]float64, 0, len(measures)+len(centroids))
+		augmented = append(augmented, measures...)
+		for _, centroid := range centroids {
+			augmented = append(augmented, distance(centroid, measures))
+		}
+		iris[i].Measures = augmented
+	}
+}
+
+// LabelTransfer clusters train into k clusters, maps each cluster to its majority label, and
+// predicts the label of each test record from its nearest train centroid. A multi label record
+// counts toward each of its labels. The Cluster field of the train records is set.
+// Without clusters, a non positive k or no train records, every prediction is empty.
+func LabelTransfer(train, test []Fisher, k int) []string {
+	centroids, _ := KMeans(train, k, 1, DefaultTolerance, DefaultMaxIterations)
+	predictions := make([]string, len(test))
+	if len(centroids) == 0 {
+		return predictions
+	}
+	labels := make([]string, 0, 8)
+	ids := make(map[string]int)
+	for _, value := range train {
+		for _, label := range value.AllLabels() {
+			if _, ok := ids[label]; !ok {
+				ids[label] = 0
+				labels = append(labels, label)
+			}
+		}
+	}
+	sort.Strings(labels)
+	for i, label := range labels {
+		ids[label] = i
+	}
+	counts := make([][]float64, len(centroids))
+	for i := range counts {
+		counts[i] = make([]float64, len(labels))
+	}
+	for _, value := range train {
+		for _, label := range value.AllLabels() {
+			counts[value.Cluster][ids[label]]++
+		}
+	}
+	majority := make([]string, len(centroids))
+	for i, count := range counts {
+		majority[i] = labels[argmax(count)]
+	}
+	for i, value := range test {
+		predictions[i] = majority[nearest(centroids, value.Measures)]
+	}
+	return predictions
+}
+
+// entropy computes the shannon entropy of the counts, using 0·log0 = 0
+func entropy(counts map[int]float64, n float64) float64 {
+	h := 0.0
+	for _, count := range counts {
+		if count > 0 {
+			p := count / n
+			h -= p * math.Log(p)
+		}
+	}
+	return h
+}
+
+// NMI computes the normalized mutual information between the Cluster of each record and its label,
+// labels are mapped with Labels and unknown labels are assigned new ids. A multi label record
+// contributes an equal share of one record to each of its labels. The mutual information is
+// normalized by the mean of the two entropies.
+func NMI(iris []Fisher) float64 {
+	if len(iris) == 0 {
+		return 0
+	}
+	ids := make(map[string]int, len(Labels))
+	for label, id := range Labels {
+		ids[label] = id
+	}
+	type pair struct {
+		cluster, label int
+	}
+	clusters, labels, joint := make(map[int]float64), make(map[int]float64), make(map[pair]float64)
+	for _, value := range iris {
+		all := value.AllLabels()
+		share := 1 / float64(len(all))
+		for _, label := range all {
+			id, ok := ids[label]
+			if !ok {
+				id = len(ids)
+				ids[label] = id
+			}
+			labels[id] += share
+			joint[pair{cluster: value.Cluster, label: id}] += share
+		}
+		clusters[value.Cluster]++
+	}
+	n := float64(len(iris))
+	mutual := 0.0
+	for key, count := range joint {
+		p := count / n
+		mutual += p * math.Log(p/((clusters[key.cluster]/n)*(labels[key.label]/n)))
+	}
+	hc, hl := entropy(clusters, n), entropy(labels, n)
+	if hc+hl == 0 {
+		return 1
+	}
+	return 2 * mutual / (hc + hl)
+}
+
+// Purity computes the fraction of records carrying the majority label of their Cluster,
+// a multi label record counts toward each of its labels
+func Purity(iris []Fisher) float64 {
+	if len(iris) == 0 {
+		return 0
+	}
+	counts := make(map[int]map[string]int)
+	for _, value := range iris {
+		if counts[value.Cluster] == nil {
+			counts[value.Cluster] = make(map[string]int)
+		}
+		for _, label := range value.AllLabels() {
+			counts[value.Cluster][label]++
+		}
+	}
+	majority := 0
+	for _, labels := range counts {
+		max := 0
+		for _, count := range labels {
+			if count > max {
+				max = count
+			}
+		}
+		majority += max
+	}
+	return float64(majority) / float64(len(iris))
+}
+
+// ClusterPipeline standardizes a copy of the data set, embeds it with the unit normalized rows of the k
+// leading eigenvectors of the symmetrized attention matrix, clusters the embedding with kmeans, and returns
+// the purity of the clusters. The attention matrix is built as process builds it, from the features, the
+// adjacency, and the softmax temperature of the configuration; FeatureSpace is an error since the records
+// are clustered, and the settings of the self attention output and the comparison do not apply.
+func ClusterPipeline(iris []Fisher, k int, cfg Config) (purity float64, err error) {
+	if cfg.FeatureSpace {
+		return 0, errors.New("the cluster pipeline clusters the records, FeatureSpace is not supported")
+	}
+	iris, err = prepare(iris, cfg)
+	if err != nil {
+		return 0, err
+	}
+	if k < 1 || k > len(iris) {
+		return 0, errors.New("k must be in [1, number of records]")
+	}
+	standardized := make([]Fisher, len(iris))
+	for i, value := range iris {
+		value.Measures = append([]float64{}, value.Measures...)
+		standardized[i] = value
+	}
+	Standardize(standardized)
+	a := features(standardized, cfg)
+	n := len(standardized)
+	adj := mat.NewDense(n, n, nil)
+	buildAdjacency(adj, a, cfg)
+	if cfg.Softmax {
+		softmaxRows(adj, cfg.Temperature)
+	}
+	var eig mat.EigenSym
+	if !eig.Factorize(Symmetrize(adj), true) {
+		return 0, ErrEigenFailed
+	}
+	var vectors mat.Dense
+	eig.VectorsTo(&vectors)
+	// the eigenvalues are in ascending order
+	for i := range standardized {
+		embedding := make([]float64, k)
+		for c := range k {
+			embedding[c] = vectors.At(i, n-1-c)
+		}
+		if norm := abs(embedding); norm > 0 {
+			floats.Scale(1/norm, embedding)
+		}
+		standardized[i].Measures = embedding
+	}
+	KMeans(standardized, k, 1, DefaultTolerance, DefaultMaxIterations)
+	return Purity(standardized), nil
+}
@@ -0,0 +1,206 @@
+// Copyright 2025 The Lemma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// multiLabel creates a record with the measures, cluster, and labels
+func multiLabel(cluster int, measures []float64, labels ...string) Fisher {
+	value := Fisher{Measures: measures, Cluster: cluster}
+	value.SetLabels(labels...)
+	return value
+}
+
+func TestMultiLabelCounts(t *testing.T) {
+	iris := []Fisher{
+		multiLabel(0, []float64{0}, "a", "b"),
+		multiLabel(0, []float64{0}, "a"),
+		multiLabel(1, []float64{1}, "c"),
+		multiLabel(1, []float64{1}, "b", "c"),
+	}
+	counts := LabelCounts(iris)
+	for _, label := range []string{"a", "b", "c"} {
+		if counts[label] != 2 {
+			t.Fatalf("label %s counted %d times, expected 2", label, counts[label])
+		}
+	}
+	if purity := Purity(iris); purity != 1 {
+		t.Fatalf("purity %v, expected 1", purity)
+	}
+	nmi := NMI(iris)
+	primary := make([]Fisher, len(iris))
+	for i, value := range iris {
+		value.Labels = nil
+		primary[i] = value
+	}
+	if nmi <= 0 || nmi >= 1 || nmi == NMI(primary) {
+		t.Fatalf("multi label nmi %v, primary label nmi %v", nmi, NMI(primary))
+	}
+}
+
+func TestLabelTransferMultiLabel(t *testing.T) {
+	train := []Fisher{
+		multiLabel(0, []float64{0, 0}, "x", "y"),
+		multiLabel(0, []float64{0, .1}, "z", "y"),
+		multiLabel(0, []float64{.1, 0}, "w", "y"),
+		multiLabel(0, []float64{10, 10}, "q"),
+		multiLabel(0, []float64{10, 10.1}, "q"),
+		multiLabel(0, []float64{10.1, 10}, "q"),
+	}
+	test := []Fisher{{Measures: []float64{.05, .05}}, {Measures: []float64{10, 10}}}
+	predictions := LabelTransfer(train, test, 2)
+	if predictions[0] != "y" || predictions[1] != "q" {
+		t.Fatalf("predictions %v, expected [y q]", predictions)
+	}
+}
+
+// split splits the data set into the even and odd indexed records
+func split(iris []Fisher) (even, odd []Fisher) {
+	for i, value := range iris {
+		if i%2 == 0 {
+			even = append(even, value)
+		} else {
+			odd = append(odd, value)
+		}
+	}
+	return even, odd
+}
+
+func TestLabelTransfer(t *testing.T) {
+	train, test := split(Load())
+	predictions := LabelTransfer(train, test, 3)
+	correct := 0
+	for i, value := range test {
+		if predictions[i] == value.Label {
+			correct++
+		}
+	}
+	if accuracy := float64(correct) / float64(len(test)); accuracy < .85 {
+		t.Fatalf("accuracy %v, expected at least .85", accuracy)
+	}
+	for _, k := range []int{0, -1} {
+		predictions := LabelTransfer(train, test, k)
+		if len(predictions) != len(test) {
+			t.Fatalf("k %d: got %d predictions, expected %d", k, len(predictions), len(test))
+		}
+		for i, prediction := range predictions {
+			if prediction != "" {
+				t.Fatalf("k %d: prediction %d is %q, expected none", k, i, prediction)
+			}
+		}
+	}
+}
+
+func TestClusterPipeline(t *testing.T) {
+	cfg := DefaultConfig()
+	purity, err := ClusterPipeline(Load(), 3, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purity < .7 {
+		t.Fatalf("purity %v, expected at least .7", purity)
+	}
+	// the softmax temperature of the configuration shapes the attention matrix
+	cfg.Temperature = 10
+	hot, err := ClusterPipeline(Load(), 3, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hot == purity {
+		t.Fatalf("temperature 10 purity %v, expected it to differ from %v", hot, purity)
+	}
+	cfg = DefaultConfig()
+	cfg.FeatureSpace = true
+	if _, err := ClusterPipeline(Load(), 3, cfg); err == nil {
+		t.Fatal("expected an error for FeatureSpace")
+	}
+}
+
+func TestKMeansTolerance(t *testing.T) {
+	_, tight := KMeans(Load(), 3, 1, 1e-12, 100)
+	_, loose := KMeans(Load(), 3, 1, 10, 100)
+	if tight <= loose {
+		t.Fatalf("tolerance 1e-12 used %d iterations and 10 used %d, expected more for the tighter tolerance", tight, loose)
+	}
+	if _, capped := KMeans(Load(), 3, 1, 1e-12, 2); capped != 2 {
+		t.Fatalf("used %d iterations, expected the maximum of 2", capped)
+	}
+}
+
+func TestLabelCentroids(t *testing.T) {
+	centroids := LabelCentroids(Load())
+	if len(centroids) != 3 {
+		t.Fatalf("got %d centroids, expected 3", len(centroids))
+	}
+	for _, label := range Inverse {
+		if len(centroids[label]) != 4 {
+			t.Fatalf("centroid %s has width %d, expected 4", label, len(centroids[label]))
+		}
+	}
+	// the mean sepal length of each species
+	for label, want := range map[string]float64{"Iris-setosa": 5.006, "Iris-versicolor": 5.936, "Iris-virginica": 6.588} {
+		if math.Abs(centroids[label][0]-want) > 1e-9 {
+			t.Fatalf("centroid %s sepal length %v, expected %v", label, centroids[label][0], want)
+		}
+	}
+}
+
+func TestClassifyNearestCentroid(t *testing.T) {
+	train, test := split(Load())
+	correct := 0
+	for _, value := range test {
+		if ClassifyNearestCentroid(train, value.Measures) == value.Label {
+			correct++
+		}
+	}
+	if accuracy := float64(correct) / float64(len(test)); accuracy < .9 {
+		t.Fatalf("accuracy %v, expected at least .9", accuracy)
+	}
+	if label := ClassifyNearestCentroid(nil, []float64{1}); label != "" {
+		t.Fatalf("label %q without train records, expected none", label)
+	}
+}
+
+func TestAugmentWithClusterDistances(t *testing.T) {
+	iris, original := Load(), Load()
+	centroids, _ := KMeans(original, 3, 1, DefaultTolerance, DefaultMaxIterations)
+	AugmentWithClusterDistances(iris, 3)
+	for i, value := range iris {
+		if len(value.Measures) != 4+3 {
+			t.Fatalf("record %d has width %d, expected 7", i, len(value.Measures))
+		}
+		for j, measure := range original[i].Measures {
+			if value.Measures[j] != measure {
+				t.Fatalf("record %d measure %d is %v, expected %v", i, j, value.Measures[j], measure)
+			}
+		}
+		for j, centroid := range centroids {
+			if d := distance(centroid, original[i].Measures); value.Measures[4+j] != d {
+				t.Fatalf("record %d distance %d is %v, expected %v", i, j, value.Measures[4+j], d)
+			}
+		}
+	}
+}
+
+func TestNMI(t *testing.T) {
+	iris := Load()
+	// a perfect clustering with permuted cluster ids
+	for i := range iris {
+		iris[i].Cluster = (Labels[iris[i].Label] + 1) % 3
+	}
+	if nmi := NMI(iris); math.Abs(nmi-1) > 1e-12 {
+		t.Fatalf("perfect clustering nmi %v, expected 1", nmi)
+	}
+	// a single cluster carries no information about the labels
+	for i := range iris {
+		iris[i].Cluster = 0
+	}
+	if nmi := NMI(iris); math.Abs(nmi) > 1e-12 {
+		t.Fatalf("single cluster nmi %v, expected 0", nmi)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2025 The Lemma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"text/tabwriter"
+)
+
+// Commands maps the subcommand names to their handlers
+var Commands = map[string]func(args []string) error{
+	"process": processCommand,
+	"cluster": clusterCommand,
+	"export":  exportCommand,
+	"compare": compareCommand,
+	"stats":   statsCommand,
+}
+
+// flagConfig builds the configuration from the global flags
+func flagConfig() (Config, error) {
+	cfg := DefaultConfig()
+	cfg.Eigen = *FlagEigen
+	cfg.Attention = *FlagAttention
+	cfg.Workers = *FlagWorkers
+	policy, ok := Policies[*FlagNonFinite]
+	if !ok {
+		return Config{}, fmt.Errorf("unknown non finite policy %q", *FlagNonFinite)
+	}
+	cfg.NonFinite = policy
+	return cfg, nil
+}
+
+// processCommand processes the iris data set and prints the result
+func processCommand(args []string) error {
+	flags := flag.NewFlagSet("process", flag.ContinueOnError)
+	raw := flags.Bool("raw", false, "use the adjacency matrix without softmax")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := flagConfig()
+	if err != nil {
+		return err
+	}
+	cfg.Softmax = !*raw
+	iris := Load()
+	if err := validate(iris, cfg); err != nil {
+		return err
+	}
+	result, err := process(iris, cfg)
+	if err != nil {
+		return err
+	}
+	return printResult(os.Stdout, result)
+}
+
+// printResult prints the result as a single row table
+func printResult(out io.Writer, result Result) error {
+	w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(w, "|eigenvalue\t|mag eigenvector\t|mag self attention\t|cosine similarity|\n")
+	fmt.Fprintf(w, "| -----------: \t| -----------: \t| -----------: \t| -----------: \t|\n")
+	fmt.Fprintf(w, "|%f\t|%f\t|%f\t|%s|\n", result.EigenValue, result.MagnitudeEigenvector, result.MagnitudeSelfAttention, formatSimilarity(result.CosineSimilarity))
+	return w.Flush()
+}
+
+// clusterCommand clusters the iris data set with kmeans and prints the label counts of each cluster
+func clusterCommand(args []string) error {
+	flags := flag.NewFlagSet("cluster", flag.ContinueOnError)
+	k := flags.Int("k", 3, "number of clusters")
+	seed := flags.Int64("seed", 1, "seed for the initial centroids")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *k < 1 {
+		return fmt.Errorf("k must be positive, got %d", *k)
+	}
+	iris := Load()
+	_, iterations := KMeans(iris, *k, *seed, DefaultTolerance, DefaultMaxIterations)
+	counts := make(map[string][]int)
+	for _, value := range iris {
+		if counts[value.Label] == nil {
+			counts[value.Label] = make([]int, *k)
+		}
+		counts[value.Label][value.Cluster]++
+	}
+	labels := make([]string, 0, len(counts))
+	for label := range counts {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(w, "|label")
+	for c := range *k {
+		fmt.Fprintf(w, "\t|cluster %d", c)
+	}
+	fmt.Fprintf(w, "|\n")
+	for _, label := range labels {
+		fmt.Fprintf(w, "|%s", label)
+		for _, count := range counts[label] {
+			fmt.Fprintf(w, "\t|%d", count)
+		}
+		fmt.Fprintf(w, "|\n")
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\nconverged in %d iterations\n", iterations)
+	return nil
+}
+
+// exportCommand exports the attention graph of the iris data set
+func exportCommand(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	dot := flags.String("dot", "", "write the attention graph as graphviz dot to the file")
+	top := flags.Int("top", 150, "number of highest weighted attention pairs in the graph")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *dot == "" {
+		return fmt.Errorf("export requires -dot")
+	}
+	out, err := os.Create(*dot)
+	if err != nil {
+		return err
+	}
+	if err := WriteDOT(out, Load(), *top); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// compareCommand processes two csv files and prints both similarities and their absolute difference
+func compareCommand(args []string) error {
+	flags := flag.NewFlagSet("compare", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("compare requires two files, got %d", flags.NArg())
+	}
+	a, err := LoadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := LoadFile(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	if len(a) > 0 && len(b) > 0 && len(a[0].Measures) != len(b[0].Measures) {
+		return fmt.Errorf("%s has %d measures and %s has %d", flags.Arg(0), len(a[0].Measures), flags.Arg(1), len(b[0].Measures))
+	}
+	cfg, err := flagConfig()
+	if err != nil {
+		return err
+	}
+	x, err := ProcessSimilarity(a, cfg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", flags.Arg(0), err)
+	}
+	y, err := ProcessSimilarity(b, cfg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", flags.Arg(1), err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(w, "|%s\t|%s\t|difference|\n", flags.Arg(0), flags.Arg(1))
+	fmt.Fprintf(w, "| -----------: \t| -----------: \t| -----------: \t|\n")
+	fmt.Fprintf(w, "|%s\t|%s\t|%s|\n", formatSimilarity(x), formatSimilarity(y), formatSimilarity(math.Abs(x-y)))
+	return w.Flush()
+}
+
+// statsCommand prints the summary statistics of each measure of a data set
+func statsCommand(args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+	data := flags.String("data", "", "csv file to summarize instead of the iris data set, - reads stdin")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := flagConfig()
+	if err != nil {
+		return err
+	}
+	var iris []Fisher
+	if *data == "" {
+		iris = Load()
+	} else if iris, err = LoadFile(*data); err != nil {
+		return err
+	}
+	if iris, err = Sanitize(iris, cfg.NonFinite); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(w, "|measure\t|min\t|max\t|mean\t|std|\n")
+	fmt.Fprintf(w, "| -----------: \t| -----------: \t| -----------: \t| -----------: \t| -----------: \t|\n")
+	for i, stats := range Summarize(iris) {
+		fmt.Fprintf(w, "|%d\t|%f\t|%f\t|%f\t|%f|\n", i, stats[0], stats[1], stats[2], stats[3])
+	}
+	return w.Flush()
+}
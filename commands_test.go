@@ -0,0 +1,97 @@
+// Copyright 2025 The Lemma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCommands(t *testing.T) {
+	handlers := map[string]func(args []string) error{
+		"process": processCommand,
+		"cluster": clusterCommand,
+		"export":  exportCommand,
+		"compare": compareCommand,
+		"stats":   statsCommand,
+	}
+	if len(Commands) != len(handlers) {
+		t.Fatalf("got %d commands, expected %d", len(Commands), len(handlers))
+	}
+	for name, handler := range handlers {
+		if reflect.ValueOf(Commands[name]).Pointer() != reflect.ValueOf(handler).Pointer() {
+			t.Fatalf("command %s does not dispatch to its handler", name)
+		}
+	}
+	dot := filepath.Join(t.TempDir(), "out.dot")
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"process"}, "cosine similarity"},
+		{[]string{"cluster", "-k", "2"}, "cluster 1"},
+		{[]string{"stats"}, "|measure"},
+		{[]string{"export", "-dot", dot}, ""},
+	} {
+		stdout, code := lemma(t, test.args...)
+		if code != 0 || !strings.Contains(stdout, test.want) {
+			t.Fatalf("%v exited with %d and wrote %q, expected %q", test.args, code, stdout, test.want)
+		}
+	}
+	if data, err := os.ReadFile(dot); err != nil || !strings.HasPrefix(string(data), "digraph attention {") {
+		t.Fatalf("export wrote %q, %v", data, err)
+	}
+	if _, code := lemma(t, "unknown"); code != 2 {
+		t.Fatalf("unknown command exited with %d, expected 2", code)
+	}
+}
+
+// writeCSV writes the data set to a csv file in the directory and returns its path
+func writeCSV(t *testing.T, dir, name string, iris []Fisher) string {
+	t.Helper()
+	var buffer bytes.Buffer
+	if err := WriteCSV(&buffer, iris); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, buffer.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCompareCommand(t *testing.T) {
+	dir := t.TempDir()
+	iris, random := Load(), Random(1)
+	a, b := writeCSV(t, dir, "a.csv", iris), writeCSV(t, dir, "b.csv", random)
+	x, err := ProcessSimilarity(iris, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	y, err := ProcessSimilarity(random, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, code := lemma(t, "compare", a, b)
+	if code != 0 {
+		t.Fatalf("compare exited with %d", code)
+	}
+	for _, want := range []string{a, b, formatSimilarity(x), formatSimilarity(y), formatSimilarity(math.Abs(x - y))} {
+		if !strings.Contains(stdout, want) {
+			t.Fatalf("compare wrote %q, expected it to contain %q", stdout, want)
+		}
+	}
+	narrow := writeCSV(t, dir, "narrow.csv", []Fisher{{Measures: []float64{1, 2}, Label: "a"}})
+	for _, args := range [][]string{{"compare", a}, {"compare", a, narrow}} {
+		if _, code := lemma(t, args...); code != 1 {
+			t.Fatalf("%v exited with %d, expected 1", args, code)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2025 The Lemma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"math/cmplx"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// WriteEigenCSV writes the magnitudes of the components of the adjacency eigenvectors with the largest
+// eigenvalue magnitudes as csv, eigen0 is the dominant mode
+func WriteEigenCSV(w io.Writer, iris []Fisher, components int) error {
+	eigenvectors, err := EigenvectorColumns(iris, components)
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(w)
+	header := make([]string, 0, components+1)
+	for c := range components {
+		header = append(header, fmt.Sprintf("eigen%d", c))
+	}
+	header = append(header, "label")
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for r, value := range iris {
+		record := make([]string, 0, components+1)
+		for c := range components {
+			record = append(record, strconv.FormatFloat(cmplx.Abs(eigenvectors.At(r, c)), 'f', -1, 64))
+		}
+		record = append(record, value.Label)
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteDOT writes the n highest weighted attention pairs of the data set as a graphviz dot graph
+func WriteDOT(w io.Writer, iris []Fisher, n int) error {
+	if _, err := fmt.Fprintln(w, "digraph attention {"); err != nil {
+		return err
+	}
+	for i, value := range iris {
+		if _, err := fmt.Fprintf(w, "\t%d [label=%q];\n", i, value.Label); err != nil {
+			return err
+		}
+	}
+	for _, pair := range TopPairs(iris, n) {
+		if _, err := fmt.Fprintf(w, "\t%d -> %d [weight=%s];\n", pair.I, pair.J,
+			strconv.FormatFloat(pair.Weight, 'f', -1, 64)); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// heat maps a value in [0,1] to a color on a blue to red gradient
+func heat(value float64) color.RGBA {
+	return color.RGBA{
+		R: uint8(math.Round(255 * value)),
+		G: 0,
+		B: uint8(math.Round(255 * (1 - value))),
+		A: 255,
+	}
+}
+
+// WriteHeatmapPNG writes the matrix as a png heatmap with one pixel per entry,
+// the values are normalized to [0,1] before coloring
+func WriteHeatmapPNG(w io.Writer, m mat.Matrix) error {
+	rows, cols := m.Dims()
+	if rows == 0 || cols == 0 {
+		return errors.New("empty matrix")
+	}
+	min, max := math.Inf(1), math.Inf(-1)
+	for i := range rows {
+		for j := range cols {
+			value := m.At(i, j)
+			min, max = math.Min(min, value), math.Max(max, value)
+		}
+	}
+	spread := max - min
+	img := image.NewRGBA(image.Rect(0, 0, cols, rows))
+	for i := range rows {
+		for j := range cols {
+			value := 0.0
+			if spread > 0 {
+				value = (m.At(i, j) - min) / spread
+			}
+			img.SetRGBA(j, i, heat(value))
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// Embed2D computes a spectral layout of the data set from the component magnitudes of the two adjacency
+// eigenvectors with the largest eigenvalue magnitudes
+func Embed2D(iris []Fisher) ([][2]float64, error) {
+	eigenvectors, err := EigenvectorColumns(iris, 2)
+	if err != nil {
+		return nil, err
+	}
+	coordinates := make([][2]float64, len(iris))
+	for r := range coordinates {
+		coordinates[r] = [2]float64{cmplx.Abs(eigenvectors.At(r, 0)), cmplx.Abs(eigenvectors.At(r, 1))}
+	}
+	return coordinates, nil
+}
+
+// WriteCSV writes the data set as csv with the measures followed by the label, the format read by LoadReader
+func WriteCSV(w io.Writer, iris []Fisher) error {
+	writer := csv.NewWriter(w)
+	for _, value := range iris {
+		record := make([]string, 0, len(value.Measures)+1)
+		for _, measure := range value.Measures {
+			record = append(record, strconv.FormatFloat(measure, 'f', -1, 64))
+		}
+		record = append(record, value.Label)
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// filename sanitizes the label for use as a file name, characters other than letters, digits,
+// '.', '-', and '_' are replaced with '_'
+func filename(label string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, label)
+	if strings.Trim(name, ".") == "" {
+		name = "_" + name
+	}
+	return name
+}
+
+// SplitByLabelToDir writes the records of each label to a csv file named after the sanitized label in dir
+func SplitByLabelToDir(iris []Fisher, dir string) error {
+	labels, groups := make(map[string]string), make(map[string][]Fisher)
+	names := make([]string, 0, 8)
+	for _, value := range iris {
+		name := filename(value.Label)
+		if label, ok := labels[name]; ok && label != value.Label {
+			return fmt.Errorf("labels %q and %q have the same file name %s.csv", label, value.Label, name)
+		} else if !ok {
+			labels[name] = value.Label
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], value)
+	}
+	for _, name := range names {
+		out, err := os.Create(filepath.Join(dir, name+".csv"))
+		if err != nil {
+			return err
+		}
+		if err := WriteCSV(out, groups[name]); err != nil {
+			out.Close()
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteSpectrumCSV writes the eigenvalue magnitudes of the adjacency matrix in descending order, one per line
+func WriteSpectrumCSV(w io.Writer, iris []Fisher) error {
+	values, err := Eigenvalues(iris)
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(w)
+	for _, value := range values {
+		if err := writer.Write([]string{strconv.FormatFloat(value, 'f', -1, 64)}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
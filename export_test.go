@@ -0,0 +1,172 @@
+// Copyright 2025 The Lemma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"image/png"
+	"math"
+	"math/cmplx"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestEigenvectorColumnsDominant(t *testing.T) {
+	iris := Random(1)
+	columns, err := EigenvectorColumns(iris, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := Eigenvalues(iris)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adj := Adjacency(iris)
+	n := len(iris)
+	for c := range 2 {
+		// the rayleigh quotient of the column is its eigenvalue
+		quotient := complex(0, 0)
+		for i := range n {
+			for j := range n {
+				quotient += cmplx.Conj(columns.At(i, c)) * complex(adj.At(i, j), 0) * columns.At(j, c)
+			}
+		}
+		if math.Abs(cmplx.Abs(quotient)-values[c]) > 1e-6*values[0] {
+			t.Fatalf("column %d has eigenvalue %v, expected %v", c, cmplx.Abs(quotient), values[c])
+		}
+	}
+}
+
+func TestEmbed2D(t *testing.T) {
+	coordinates, err := Embed2D(Load())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(coordinates) != 150 {
+		t.Fatalf("got %d coordinates, expected 150", len(coordinates))
+	}
+	for i, coordinate := range coordinates {
+		for _, value := range coordinate {
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				t.Fatalf("coordinate %d is %v", i, coordinate)
+			}
+		}
+	}
+}
+
+func TestWriteEigenCSV(t *testing.T) {
+	iris := Load()
+	var buffer bytes.Buffer
+	if err := WriteEigenCSV(&buffer, iris, 3); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buffer).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != len(iris)+1 {
+		t.Fatalf("got %d rows, expected %d", len(records), len(iris)+1)
+	}
+	if header := strings.Join(records[0], ","); header != "eigen0,eigen1,eigen2,label" {
+		t.Fatalf("header %q, expected eigen0,eigen1,eigen2,label", header)
+	}
+	for i, record := range records[1:] {
+		if record[3] != iris[i].Label {
+			t.Fatalf("row %d has label %q, expected %q", i, record[3], iris[i].Label)
+		}
+	}
+}
+
+func TestWriteHeatmapPNG(t *testing.T) {
+	m := mat.NewDense(2, 3, []float64{
+		0, 1, 2,
+		3, 4, 5,
+	})
+	var buffer bytes.Buffer
+	if err := WriteHeatmapPNG(&buffer, m); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 3 || bounds.Dy() != 2 {
+		t.Fatalf("got a %d×%d image, expected 3×2", bounds.Dx(), bounds.Dy())
+	}
+	// the minimum is blue and the maximum is red
+	if r, _, b, _ := img.At(0, 0).RGBA(); r != 0 || b != 0xffff {
+		t.Fatalf("the minimum pixel is %v, expected blue", img.At(0, 0))
+	}
+	if r, _, b, _ := img.At(2, 1).RGBA(); r != 0xffff || b != 0 {
+		t.Fatalf("the maximum pixel is %v, expected red", img.At(2, 1))
+	}
+	if err := WriteHeatmapPNG(&buffer, &mat.Dense{}); err == nil {
+		t.Fatal("expected an error for an empty matrix")
+	}
+}
+
+func TestSplitByLabelToDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := SplitByLabelToDir(Load(), dir); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d files, expected 3", len(entries))
+	}
+	for _, label := range Inverse {
+		iris, err := LoadFile(filepath.Join(dir, label+".csv"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(iris) != 50 {
+			t.Fatalf("%s has %d records, expected 50", label, len(iris))
+		}
+		for i, value := range iris {
+			if value.Label != label {
+				t.Fatalf("%s record %d is %s", label, i, value.Label)
+			}
+		}
+	}
+	// labels that sanitize to the same file name are an error
+	collide := []Fisher{{Label: "a b", Measures: []float64{1}}, {Label: "a/b", Measures: []float64{2}}}
+	if err := SplitByLabelToDir(collide, t.TempDir()); err == nil {
+		t.Fatal("expected an error for colliding file names")
+	}
+}
+
+func TestWriteSpectrumCSV(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := WriteSpectrumCSV(&buffer, Load()); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+	if len(lines) != 150 {
+		t.Fatalf("got %d lines, expected 150", len(lines))
+	}
+	previous := math.Inf(1)
+	for i, line := range lines {
+		value, err := strconv.ParseFloat(line, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value < 0 || value > previous {
+			t.Fatalf("line %d is %v after %v, expected non negative magnitudes in descending order", i, value, previous)
+		}
+		previous = value
+	}
+	if err := WriteSpectrumCSV(&buffer, nil); err == nil {
+		t.Fatal("expected an error for no records")
+	}
+}
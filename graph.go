@@ -0,0 +1,144 @@
+// Copyright 2025 The Lemma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// Pair is a pair of records and the attention weight from the first to the second
+type Pair struct {
+	I, J   int
+	Weight float64
+}
+
+// TopPairs returns the n off diagonal pairs with the highest softmax attention weight sorted in descending order,
+// a non positive n returns no pairs
+func TopPairs(iris []Fisher, n int) []Pair {
+	if n <= 0 {
+		return nil
+	}
+	attention := Attention(iris)
+	pairs := make([]Pair, 0, len(iris)*len(iris))
+	for i := range iris {
+		for j := range iris {
+			if i == j {
+				continue
+			}
+			pairs = append(pairs, Pair{I: i, J: j, Weight: attention.At(i, j)})
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].Weight > pairs[j].Weight
+	})
+	if n < len(pairs) {
+		pairs = pairs[:n]
+	}
+	return pairs
+}
+
+// Outliers returns the indices of the k records with the lowest maximum off diagonal softmax attention weight,
+// a non positive k returns no indices
+func Outliers(iris []Fisher, k int) []int {
+	if k <= 0 {
+		return nil
+	}
+	attention := Attention(iris)
+	weights := make([]float64, len(iris))
+	for i := range iris {
+		max := 0.0
+		for j, weight := range attention.RawRowView(i) {
+			if i != j && weight > max {
+				max = weight
+			}
+		}
+		weights[i] = max
+	}
+	indices := make([]int, len(iris))
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.SliceStable(indices, func(i, j int) bool {
+		return weights[indices[i]] < weights[indices[j]]
+	})
+	if k < len(indices) {
+		indices = indices[:k]
+	}
+	return indices
+}
+
+// AttentionEntropy computes the shannon entropy of each row of the softmax attention matrix
+func AttentionEntropy(iris []Fisher) []float64 {
+	attention := Attention(iris)
+	entropy := make([]float64, len(iris))
+	for i := range iris {
+		sum := 0.0
+		for _, weight := range attention.RawRowView(i) {
+			if weight > 0 {
+				sum -= weight * math.Log(weight)
+			}
+		}
+		entropy[i] = sum
+	}
+	return entropy
+}
+
+// DegreeCentrality computes the total attention each record receives, the column sums of the softmax attention matrix
+func DegreeCentrality(iris []Fisher) []float64 {
+	attention := Attention(iris)
+	centrality := make([]float64, len(iris))
+	for i := range iris {
+		for j, weight := range attention.RawRowView(i) {
+			centrality[j] += weight
+		}
+	}
+	return centrality
+}
+
+// PageRank ranks the records by running iters power iterations of the random walk over the row stochastic
+// softmax attention matrix, teleporting uniformly with probability 1 - damping
+func PageRank(iris []Fisher, damping float64, iters int) []float64 {
+	n := len(iris)
+	if n == 0 {
+		return nil
+	}
+	attention := Attention(iris)
+	rank, next := make([]float64, n), make([]float64, n)
+	for i := range rank {
+		rank[i] = 1 / float64(n)
+	}
+	for range iters {
+		for j := range next {
+			next[j] = (1 - damping) / float64(n)
+		}
+		for i := range n {
+			for j, weight := range attention.RawRowView(i) {
+				next[j] += damping * rank[i] * weight
+			}
+		}
+		rank, next = next, rank
+	}
+	return rank
+}
+
+// NearestNeighbors returns the index of the other record with the highest cosine similarity to each record,
+// ties go to the lower index and a record without others has -1
+func NearestNeighbors(iris []Fisher) []int {
+	neighbors := make([]int, len(iris))
+	for i := range iris {
+		neighbors[i] = -1
+		best := math.Inf(-1)
+		for j := range iris {
+			if j == i {
+				continue
+			}
+			if similarity := cs(iris[i].Measures, iris[j].Measures); similarity > best {
+				neighbors[i], best = j, similarity
+			}
+		}
+	}
+	return neighbors
+}
@@ -0,0 +1,128 @@
+// Copyright 2025 The Lemma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTopPairs(t *testing.T) {
+	iris := []Fisher{
+		{Measures: []float64{1, 0}},
+		{Measures: []float64{1, .1}},
+		{Measures: []float64{0, 1}},
+	}
+	pairs := TopPairs(iris, 6)
+	if len(pairs) != 6 {
+		t.Fatalf("got %d pairs, expected the 6 off diagonal pairs", len(pairs))
+	}
+	for i, pair := range pairs {
+		if pair.I == pair.J {
+			t.Fatalf("pair %d is on the diagonal", i)
+		}
+		if i > 0 && pair.Weight > pairs[i-1].Weight {
+			t.Fatalf("pair %d weight %v is greater than the previous %v", i, pair.Weight, pairs[i-1].Weight)
+		}
+	}
+	for _, n := range []int{0, -1} {
+		if pairs := TopPairs(iris, n); len(pairs) != 0 {
+			t.Fatalf("TopPairs(%d) returned %d pairs", n, len(pairs))
+		}
+		if outliers := Outliers(iris, n); len(outliers) != 0 {
+			t.Fatalf("Outliers(%d) returned %d indices", n, len(outliers))
+		}
+	}
+}
+
+func TestOutliers(t *testing.T) {
+	iris := InjectAnomaly(Load(), 1, 1)
+	outliers := Outliers(iris, 3)
+	if len(outliers) != 3 {
+		t.Fatalf("got %d outliers, expected 3", len(outliers))
+	}
+	if outliers[0] != 150 {
+		t.Fatalf("got outlier %d, expected the injected record 150", outliers[0])
+	}
+}
+
+func TestAttentionEntropy(t *testing.T) {
+	uniform := make([]Fisher, 4)
+	for i := range uniform {
+		uniform[i].Measures = []float64{0, 0}
+	}
+	for i, entropy := range AttentionEntropy(uniform) {
+		if math.Abs(entropy-math.Log(4)) > 1e-12 {
+			t.Fatalf("uniform record %d entropy %v, expected log 4", i, entropy)
+		}
+	}
+	focused := []Fisher{
+		{Measures: []float64{100, 0, 0}},
+		{Measures: []float64{0, 100, 0}},
+		{Measures: []float64{0, 0, 100}},
+	}
+	for i, entropy := range AttentionEntropy(focused) {
+		if entropy > 1e-12 {
+			t.Fatalf("focused record %d entropy %v, expected 0", i, entropy)
+		}
+	}
+}
+
+func TestDegreeCentrality(t *testing.T) {
+	iris := Load()
+	centrality := DegreeCentrality(iris)
+	if len(centrality) != len(iris) {
+		t.Fatalf("got %d centralities, expected %d", len(centrality), len(iris))
+	}
+	// each row of the attention matrix sums to one
+	sum := 0.0
+	for _, value := range centrality {
+		sum += value
+	}
+	if math.Abs(sum-float64(len(iris))) > 1e-9 {
+		t.Fatalf("centralities sum to %v, expected %d", sum, len(iris))
+	}
+}
+
+func TestPageRank(t *testing.T) {
+	iris := Load()
+	rank := PageRank(iris, .85, 50)
+	if len(rank) != len(iris) {
+		t.Fatalf("got %d ranks, expected %d", len(rank), len(iris))
+	}
+	sum := 0.0
+	for i, value := range rank {
+		if value < 0 {
+			t.Fatalf("record %d rank %v, expected a non negative rank", i, value)
+		}
+		sum += value
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Fatalf("ranks sum to %v, expected 1", sum)
+	}
+	if rank := PageRank(nil, .85, 50); rank != nil {
+		t.Fatalf("got %v for no records, expected nil", rank)
+	}
+}
+
+func TestNearestNeighbors(t *testing.T) {
+	iris := []Fisher{
+		{Measures: []float64{1, 0}},
+		{Measures: []float64{1, .1}},
+		{Measures: []float64{0, 1}},
+		{Measures: []float64{.1, 1}},
+		// equally similar to records 1 and 3, the tie goes to the lower index
+		{Measures: []float64{1, 1}},
+	}
+	want := []int{1, 0, 3, 2, 1}
+	for i, neighbor := range NearestNeighbors(iris) {
+		if neighbor != want[i] {
+			t.Fatalf("record %d nearest neighbor %d, expected %d", i, neighbor, want[i])
+		}
+	}
+	if neighbors := NearestNeighbors(iris[:1]); neighbors[0] != -1 {
+		t.Fatalf("a single record has neighbor %d, expected -1", neighbors[0])
+	}
+}
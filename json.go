@@ -0,0 +1,74 @@
+// Copyright 2025 The Lemma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// jsonRecord is the json representation of a data set record
+type jsonRecord struct {
+	Features []float64 `json:"features"`
+	Label    string    `json:"label"`
+	Labels   []string  `json:"labels,omitempty"`
+	Cluster  int       `json:"cluster"`
+	Index    int       `json:"index"`
+}
+
+// LoadJSON loads a data set from a json array of records.
+// All records must have the same number of features; Index is assigned by order.
+// A record with labels is a multi label record and its label is the first of them.
+func LoadJSON(r io.Reader) ([]Fisher, error) {
+	var records []jsonRecord
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return nil, err
+	}
+	fisher := make([]Fisher, 0, len(records))
+	for i, record := range records {
+		if len(record.Features) == 0 {
+			return nil, fmt.Errorf("record %d has no features", i)
+		}
+		if i > 0 && len(record.Features) != len(records[0].Features) {
+			return nil, fmt.Errorf("record %d has %d features, expected %d", i, len(record.Features), len(records[0].Features))
+		}
+		value := Fisher{
+			Measures: record.Features,
+			Label:    record.Label,
+			Cluster:  record.Cluster,
+			Index:    i,
+		}
+		if len(record.Labels) > 0 {
+			value.SetLabels(record.Labels...)
+		}
+		fisher = append(fisher, value)
+	}
+	return fisher, nil
+}
+
+// WriteJSON writes the data set as a json array of records
+func WriteJSON(w io.Writer, iris []Fisher) error {
+	records := make([]jsonRecord, 0, len(iris))
+	for _, value := range iris {
+		records = append(records, jsonRecord{
+			Features: value.Measures,
+			Label:    value.Label,
+			Labels:   value.Labels,
+			Cluster:  value.Cluster,
+			Index:    value.Index,
+		})
+	}
+	return json.NewEncoder(w).Encode(records)
+}
+
+// ConvertCSVtoJSON converts a csv data set with the label in column labelCol to a json array of records
+func ConvertCSVtoJSON(in io.Reader, out io.Writer, labelCol int) error {
+	iris, err := LoadReaderColumn(in, labelCol)
+	if err != nil {
+		return err
+	}
+	return WriteJSON(out, iris)
+}
@@ -0,0 +1,85 @@
+// Copyright 2025 The Lemma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadJSON(t *testing.T) {
+	input := `[
+		{"features": [1, 2], "label": "a", "cluster": 1},
+		{"features": [3, 4], "label": "b", "labels": ["b", "c"]}
+	]`
+	iris, err := LoadJSON(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(iris) != 2 {
+		t.Fatalf("got %d records, expected 2", len(iris))
+	}
+	if iris[0].Label != "a" || iris[0].Cluster != 1 || iris[0].Measures[1] != 2 || iris[0].Index != 0 {
+		t.Fatalf("record 0 is %+v", iris[0])
+	}
+	if iris[1].Label != "b" || len(iris[1].AllLabels()) != 2 || iris[1].Measures[0] != 3 || iris[1].Index != 1 {
+		t.Fatalf("record 1 is %+v", iris[1])
+	}
+	for _, input := range []string{
+		`[{"features": [1, 2]}, {"features": [3]}]`,
+		`[{"features": []}]`,
+		`{"features": [1]}`,
+	} {
+		if _, err := LoadJSON(strings.NewReader(input)); err == nil {
+			t.Fatalf("expected an error for %s", input)
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	input := `[
+		{"features": [1.5, 2], "label": "a", "cluster": 2},
+		{"features": [3, -4.25], "label": "b", "labels": ["b", "c"], "cluster": 1}
+	]`
+	iris, err := LoadJSON(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buffer bytes.Buffer
+	if err := WriteJSON(&buffer, iris); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadJSON(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, iris) {
+		t.Fatalf("round trip gave %+v, expected %+v", loaded, iris)
+	}
+}
+
+func TestConvertCSVtoJSON(t *testing.T) {
+	input := "a,1.5,2\nb,3,-4.25\n"
+	want, err := LoadReaderColumn(strings.NewReader(input), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buffer bytes.Buffer
+	if err := ConvertCSVtoJSON(strings.NewReader(input), &buffer, 0); err != nil {
+		t.Fatal(err)
+	}
+	iris, err := LoadJSON(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(iris, want) {
+		t.Fatalf("got %+v, expected %+v", iris, want)
+	}
+	if err := ConvertCSVtoJSON(strings.NewReader("a,x\n"), &buffer, 0); err == nil {
+		t.Fatal("expected an error for a non numeric measure")
+	}
+}
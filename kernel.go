@@ -0,0 +1,49 @@
+// Copyright 2025 The Lemma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+)
+
+// KernelKind is the kind of kernel used to build the adjacency matrix
+type KernelKind int
+
+const (
+	// KernelLinear is the dot product
+	KernelLinear KernelKind = iota
+	// KernelRBF is the gaussian radial basis function exp(-gamma·|x-y|²)
+	KernelRBF
+	// KernelPolynomial is the polynomial kernel (x·y + coef0)^degree
+	KernelPolynomial
+)
+
+// Kernel is the kernel used to build the adjacency matrix
+type Kernel struct {
+	// Kind is the kind of kernel
+	Kind KernelKind
+	// Gamma is the width of the radial basis function, zero uses one over the number of measures
+	Gamma float64
+	// Degree is the degree of the polynomial kernel
+	Degree int
+	// Coef0 is the constant term of the polynomial kernel
+	Coef0 float64
+}
+
+// Compute computes the kernel of the two vectors
+func (k Kernel) Compute(a, b []float64) float64 {
+	switch k.Kind {
+	case KernelRBF:
+		gamma := k.Gamma
+		if gamma == 0 {
+			gamma = 1 / float64(len(a))
+		}
+		d := distance(a, b)
+		return math.Exp(-gamma * d * d)
+	case KernelPolynomial:
+		return math.Pow(dot(a, b)+k.Coef0, float64(k.Degree))
+	}
+	return dot(a, b)
+}
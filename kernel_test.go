@@ -0,0 +1,51 @@
+// Copyright 2025 The Lemma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestKernel(t *testing.T) {
+	iris := Load()
+	cfg := DefaultConfig()
+	cfg.Kernel = Kernel{Kind: KernelRBF}
+	result, err := ProcessFull(iris, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range iris {
+		if result.Adjacency.At(i, i) != 1 {
+			t.Fatalf("diagonal %d is %v, expected 1", i, result.Adjacency.At(i, i))
+		}
+		for j := range iris {
+			if value := result.Adjacency.At(i, j); !(value > 0 && value <= 1) {
+				t.Fatalf("entry (%d, %d) is %v, expected a value in (0, 1]", i, j, value)
+			}
+		}
+	}
+	// gamma defaults to one over the number of measures
+	if value, want := cfg.Kernel.Compute([]float64{0, 0}, []float64{1, 1}), math.Exp(-1); math.Abs(value-want) > 1e-15 {
+		t.Fatalf("rbf kernel %v, expected %v", value, want)
+	}
+	if value := (Kernel{Kind: KernelPolynomial, Degree: 2, Coef0: 1}).Compute([]float64{1, 2}, []float64{3, 4}); value != 144 {
+		t.Fatalf("polynomial kernel %v, expected 144", value)
+	}
+
+	// the linear kernel is the default dot product adjacency
+	want, err := ProcessSimilarity(iris, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Kernel = Kernel{Kind: KernelLinear}
+	similarity, err := ProcessSimilarity(iris, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if similarity != want {
+		t.Fatalf("linear kernel similarity %v, expected the default %v", similarity, want)
+	}
+}
@@ -6,31 +6,128 @@ package main
 
 import (
 	"archive/zip"
+	"bufio"
 	"bytes"
+	"crypto/sha256"
 	"embed"
+	"encoding/binary"
 	"encoding/csv"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"math"
 	"math/cmplx"
 	"math/rand"
 	"os"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"text/tabwriter"
+	"time"
 
+	"gonum.org/v1/gonum/floats"
 	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat"
 )
 
 //go:embed iris.zip
 var Iris embed.FS
 
+// DataFS is the file system Load reads iris.zip from, it can be replaced to simulate a missing or broken data set
+var DataFS fs.FS = Iris
+
 // Fisher is the fisher iris data
 type Fisher struct {
 	Measures []float64
 	Label    string
 	Cluster  int
 	Index    int
+	Tags     []string
+	// Labels are all of the labels of a multi label record, Label is the first of them
+	Labels []string
+}
+
+// AllLabels returns the labels of the record, Labels if set otherwise Label
+func (f Fisher) AllLabels() []string {
+	if len(f.Labels) > 0 {
+		return f.Labels
+	}
+	return []string{f.Label}
+}
+
+// SetLabels sets the labels of the record and syncs Label to the first of them
+func (f *Fisher) SetLabels(labels ...string) {
+	f.Labels = labels
+	f.Label = ""
+	if len(labels) > 0 {
+		f.Label = labels[0]
+	}
+}
+
+// LabelCounts counts the records of each label, a multi label record is counted for each of its labels
+func LabelCounts(iris []Fisher) map[string]int {
+	counts := make(map[string]int)
+	for _, value := range iris {
+		for _, label := range value.AllLabels() {
+			counts[label]++
+		}
+	}
+	return counts
+}
+
+// BuildLabelMap assigns an id to each label in first seen order and returns the map and the labels by id
+func BuildLabelMap(iris []Fisher) (map[string]int, []string) {
+	ids, labels := make(map[string]int), make([]string, 0, 8)
+	for _, value := range iris {
+		for _, label := range value.AllLabels() {
+			if _, ok := ids[label]; !ok {
+				ids[label] = len(labels)
+				labels = append(labels, label)
+			}
+		}
+	}
+	return ids, labels
+}
+
+// BuildLabelMapSorted is BuildLabelMap with the ids assigned in sorted label order, so they do not
+// depend on the order of the records
+func BuildLabelMapSorted(iris []Fisher) (map[string]int, []string) {
+	ids, labels := BuildLabelMap(iris)
+	sort.Strings(labels)
+	for i, label := range labels {
+		ids[label] = i
+	}
+	return ids, labels
+}
+
+// Fingerprint computes a sha-256 hex digest of the measures and labels of the records in order
+func Fingerprint(iris []Fisher) string {
+	hash := sha256.New()
+	var buffer [8]byte
+	write := func(value uint64) {
+		binary.LittleEndian.PutUint64(buffer[:], value)
+		hash.Write(buffer[:])
+	}
+	for _, value := range iris {
+		write(uint64(len(value.Measures)))
+		for _, measure := range value.Measures {
+			write(math.Float64bits(measure))
+		}
+		labels := value.AllLabels()
+		write(uint64(len(labels)))
+		for _, label := range labels {
+			write(uint64(len(label)))
+			hash.Write([]byte(label))
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))
 }
 
 // Labels maps iris labels to ints
@@ -47,63 +144,266 @@ var Inverse = [3]string{
 	"Iris-virginica",
 }
 
-// Load loads the iris data set
+// Load loads the iris data set from DataFS, it panics if the data set can not be loaded
 func Load() []Fisher {
-	file, err := Iris.Open("iris.zip")
+	fisher, err := LoadFS(DataFS)
 	if err != nil {
 		panic(err)
 	}
+	return fisher
+}
+
+// LoadFS loads the iris data set from the iris.zip file of the file system
+func LoadFS(fsys fs.FS) ([]Fisher, error) {
+	file, err := fsys.Open("iris.zip")
+	if err != nil {
+		return nil, err
+	}
 	defer file.Close()
 
-	data, err := io.ReadAll(file)
+	info, err := file.Stat()
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	at, ok := file.(io.ReaderAt)
+	if !ok {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, err
+		}
+		at = bytes.NewReader(data)
 	}
 
 	fisher := make([]Fisher, 0, 8)
-	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	reader, err := zip.NewReader(at, info.Size())
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	for _, f := range reader.File {
 		if f.Name == "iris.data" {
 			iris, err := f.Open()
 			if err != nil {
-				panic(err)
+				return nil, err
 			}
-			reader := csv.NewReader(iris)
-			data, err := reader.ReadAll()
+			records, err := LoadReader(iris)
+			iris.Close()
 			if err != nil {
-				panic(err)
+				return nil, err
 			}
-			for i, item := range data {
-				record := Fisher{
-					Measures: make([]float64, 4),
-					Label:    item[4],
-					Index:    i,
-				}
-				for ii := range item[:4] {
-					f, err := strconv.ParseFloat(item[ii], 64)
-					if err != nil {
-						panic(err)
-					}
-					record.Measures[ii] = f
-				}
-				fisher = append(fisher, record)
+			fisher = append(fisher, records...)
+		}
+	}
+	return fisher, nil
+}
+
+// LoadReader loads a csv data set with the label in the last column, streaming the records
+func LoadReader(r io.Reader) ([]Fisher, error) {
+	return LoadReaderColumn(r, -1)
+}
+
+// LoadReaderColumn loads a csv data set with the label in column label, negative indexes count from
+// the end with -1 being the last column; the remaining columns are the measures
+func LoadReaderColumn(r io.Reader, label int) ([]Fisher, error) {
+	next, err := LoadIterColumn(r, label)
+	if err != nil {
+		return nil, err
+	}
+	fisher := make([]Fisher, 0, 8)
+	for {
+		record, ok, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		fisher = append(fisher, record)
+	}
+	return fisher, nil
+}
+
+// LoadIter returns an iterator over the records of a csv data set with the label in the last column.
+// Each call returns the next record, false once the records are exhausted, or an error.
+func LoadIter(r io.Reader) (func() (Fisher, bool, error), error) {
+	return LoadIterColumn(r, -1)
+}
+
+// LoadIterColumn is LoadIter with the label in column label, negative indexes count from the end
+func LoadIterColumn(r io.Reader, label int) (func() (Fisher, bool, error), error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	index := 0
+	return func() (Fisher, bool, error) {
+		item, err := reader.Read()
+		if err == io.EOF {
+			return Fisher{}, false, nil
+		} else if err != nil {
+			return Fisher{}, false, err
+		}
+		if len(item) < 2 {
+			return Fisher{}, false, fmt.Errorf("record %d has %d columns, expected at least 2", index, len(item))
+		}
+		column := label
+		if column < 0 {
+			column += len(item)
+		}
+		if column < 0 || column >= len(item) {
+			return Fisher{}, false, fmt.Errorf("record %d has no label column %d", index, label)
+		}
+		record := Fisher{
+			Measures: make([]float64, 0, len(item)-1),
+			Label:    item[column],
+			Index:    index,
+		}
+		for ii, value := range item {
+			if ii == column {
+				continue
 			}
-			iris.Close()
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Fisher{}, false, err
+			}
+			record.Measures = append(record.Measures, f)
+		}
+		index++
+		return record, true, nil
+	}, nil
+}
+
+// LoadFile loads a csv data set from the file at path, a path of "-" reads from stdin
+func LoadFile(path string) ([]Fisher, error) {
+	if path == "-" {
+		return LoadReader(os.Stdin)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return LoadReader(file)
+}
+
+// LoadMany loads and concatenates the csv data sets of the files at paths, Index is reassigned by order
+// and all of the records must have the same number of measures
+func LoadMany(paths ...string) ([]Fisher, error) {
+	fisher := make([]Fisher, 0, 8)
+	for _, path := range paths {
+		records, err := LoadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for i, record := range records {
+			if len(fisher) > 0 && len(record.Measures) != len(fisher[0].Measures) {
+				return nil, fmt.Errorf("%s: record %d has %d measures, expected %d", path, i, len(record.Measures), len(fisher[0].Measures))
+			}
+			record.Index = len(fisher)
+			fisher = append(fisher, record)
 		}
 	}
-	return fisher
+	return fisher, nil
+}
+
+// LoadSparse loads a libsvm style data set of "label index:value ..." lines into dense measures of width dim.
+// Indexes start at 1 and missing entries are zero.
+func LoadSparse(r io.Reader, dim int) ([]Fisher, error) {
+	if dim < 1 {
+		return nil, fmt.Errorf("dimension %d is less than 1", dim)
+	}
+	scanner := bufio.NewScanner(r)
+	fisher := make([]Fisher, 0, 8)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		record := Fisher{
+			Measures: make([]float64, dim),
+			Label:    fields[0],
+			Index:    len(fisher),
+		}
+		for _, field := range fields[1:] {
+			index, value, found := strings.Cut(field, ":")
+			if !found {
+				return nil, fmt.Errorf("line %d: invalid entry %q", line, field)
+			}
+			i, err := strconv.Atoi(index)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			if i < 1 || i > dim {
+				return nil, fmt.Errorf("line %d: index %d out of range [1, %d]", line, i, dim)
+			}
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			record.Measures[i-1] = f
+		}
+		fisher = append(fisher, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return fisher, nil
+}
+
+// Kind is a kind of distribution
+type Kind int
+
+const (
+	// Uniform is the uniform distribution over [0,1)
+	Uniform Kind = iota
+	// Normal is the normal distribution
+	Normal
+	// Exponential is the exponential distribution
+	Exponential
+)
+
+// Distribution is the distribution of the random features
+type Distribution struct {
+	Kind Kind
+	// Mean is the mean of the normal distribution
+	Mean float64
+	// StdDev is the standard deviation of the normal distribution
+	StdDev float64
+	// Rate is the rate of the exponential distribution, zero means a rate of 1
+	Rate float64
+}
+
+// Sample draws a value from the distribution
+func (d Distribution) Sample(rng *rand.Rand) float64 {
+	switch d.Kind {
+	case Normal:
+		return d.Mean + d.StdDev*rng.NormFloat64()
+	case Exponential:
+		if d.Rate > 0 {
+			return rng.ExpFloat64() / d.Rate
+		}
+		return rng.ExpFloat64()
+	}
+	return rng.Float64()
 }
 
 // Random generates a random iris data set
 func Random(seed int64) []Fisher {
-	fisher, rng := make([]Fisher, 150), rand.New(rand.NewSource(seed))
+	return RandomDistribution(seed, Distribution{Kind: Uniform})
+}
+
+// RandomDistribution generates a random iris data set with features drawn from the distribution
+func RandomDistribution(seed int64, distribution Distribution) []Fisher {
+	return RandomN(seed, 150, distribution)
+}
+
+// RandomN generates a random data set of n records with four features drawn from the distribution,
+// a non positive n generates no records
+func RandomN(seed int64, n int, distribution Distribution) []Fisher {
+	fisher, rng := make([]Fisher, max(n, 0)), rand.New(rand.NewSource(seed))
 	for i := range fisher {
 		fisher[i].Measures = make([]float64, 4)
 		for ii := range fisher[i].Measures {
-			fisher[i].Measures[ii] = rng.Float64()
+			fisher[i].Measures[ii] = distribution.Sample(rng)
 		}
 		fisher[i].Label = fmt.Sprintf("%d", i)
 		fisher[i].Index = i
@@ -111,166 +411,1757 @@ func Random(seed int64) []Fisher {
 	return fisher
 }
 
+// RandomWeighted generates a random data set of n records with labels drawn according to the weights.
+// The weights are normalized; each label has its own random offset added to uniform noise.
+// A non positive n generates no records.
+func RandomWeighted(seed int64, n int, weights map[string]float64) []Fisher {
+	labels := make([]string, 0, len(weights))
+	total := 0.0
+	for label, weight := range weights {
+		if weight > 0 {
+			labels = append(labels, label)
+			total += weight
+		}
+	}
+	sort.Strings(labels)
+	fisher, rng := make([]Fisher, max(n, 0)), rand.New(rand.NewSource(seed))
+	if len(labels) == 0 {
+		return fisher[:0]
+	}
+	offsets := make(map[string][]float64, len(labels))
+	for _, label := range labels {
+		offset := make([]float64, 4)
+		for i := range offset {
+			offset[i] = rng.Float64()
+		}
+		offsets[label] = offset
+	}
+	for i := range fisher {
+		label, sample, sum := labels[len(labels)-1], rng.Float64()*total, 0.0
+		for _, l := range labels {
+			sum += weights[l]
+			if sample < sum {
+				label = l
+				break
+			}
+		}
+		fisher[i].Measures = make([]float64, 4)
+		for ii := range fisher[i].Measures {
+			fisher[i].Measures[ii] = offsets[label][ii] + rng.Float64()
+		}
+		fisher[i].Label = label
+		fisher[i].Index = i
+	}
+	return fisher
+}
+
+// InjectAnomaly returns the data set with one appended record, labeled anomaly, whose measures are
+// beyond the maximum of each column by scale times the column range
+func InjectAnomaly(iris []Fisher, scale float64, seed int64) []Fisher {
+	injected := make([]Fisher, len(iris), len(iris)+1)
+	copy(injected, iris)
+	if len(iris) == 0 {
+		return injected
+	}
+	rng := rand.New(rand.NewSource(seed))
+	measures := make([]float64, len(iris[0].Measures))
+	for i := range measures {
+		min, max := math.Inf(1), math.Inf(-1)
+		for _, value := range iris {
+			min, max = math.Min(min, value.Measures[i]), math.Max(max, value.Measures[i])
+		}
+		spread := max - min
+		if spread == 0 {
+			spread = 1
+		}
+		measures[i] = max + scale*spread*(1+rng.Float64())
+	}
+	return append(injected, Fisher{
+		Measures: measures,
+		Label:    "anomaly",
+		Index:    len(iris),
+	})
+}
+
+// Datasets maps the data set names to their loaders, n is the number of records of generated data sets
+var Datasets = map[string]func(n int) ([]Fisher, error){
+	"iris": func(n int) ([]Fisher, error) {
+		return Load(), nil
+	},
+	"wine": func(n int) ([]Fisher, error) {
+		return nil, errors.New("the wine data set is not embedded")
+	},
+	"random": func(n int) ([]Fisher, error) {
+		if n < 1 {
+			return nil, fmt.Errorf("random data set requires a positive number of records, got %d", n)
+		}
+		return RandomN(0, n, Distribution{Kind: Uniform}), nil
+	},
+}
+
+// LoadDataset loads the named data set
+func LoadDataset(name string, n int) ([]Fisher, error) {
+	loader, ok := Datasets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown data set %q", name)
+	}
+	return loader(n)
+}
+
+// Trials processes the data set followed by the random data sets seeded 1 through trials.
+// The trials are run on a pool of workers; progress, if not nil, is called after each trial completes.
+// A trial that fails has its Err set and the remaining trials continue.
+func Trials(iris []Fisher, trials int, cfg Config, progress func(done, total int)) []Result {
+	if progress == nil {
+		return runTrials(iris, trials, cfg, nil)
+	}
+	return runTrials(iris, trials, cfg, func(done, total, trial int, result Result) {
+		progress(done, total)
+	})
+}
+
+// trialData returns the data set of the trial with the seed, the data set itself for seed 0
+// and the random data set of the seed otherwise
+func trialData(iris []Fisher, seed int64) []Fisher {
+	if seed == 0 {
+		return iris
+	}
+	return Random(seed)
+}
+
+// runTrials is Trials with a progress callback that also receives the index and result of the completed trial,
+// the callback is serialized
+func runTrials(iris []Fisher, trials int, cfg Config, progress func(done, total, trial int, result Result)) []Result {
+	total := trials + 1
+	results := make([]Result, total)
+	jobs := make(chan int, total)
+	for i := range total {
+		jobs <- i
+	}
+	close(jobs)
+	var (
+		mutex sync.Mutex
+		wg    sync.WaitGroup
+		done  int
+	)
+	for range cfg.workers(total) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				data := trialData(iris, int64(i))
+				if err := validate(data, cfg); err != nil {
+					results[i].Err = err
+				} else {
+					results[i], results[i].Err = process(data, cfg)
+				}
+				if progress != nil {
+					mutex.Lock()
+					done++
+					progress(done, total, i, results[i])
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
 var (
 	// FlagEigen is which vector is used
 	FlagEigen = flag.Int("eigen", 0, "which vector is used")
 	// FlagAttention is which vector is used
 	FlagAttention = flag.Int("attention", 0, "which vector is used")
+	// FlagWorkers is the size of the worker pool
+	FlagWorkers = flag.Int("workers", runtime.GOMAXPROCS(0), "size of the worker pool, 1 runs serially")
+	// FlagEMA is the weight of the exponential moving average of the cosine similarity written to stderr
+	FlagEMA = flag.Float64("ema", 0, "weight in (0,1] of the exponential moving average of the cosine similarity written to stderr as trials complete, 0 disables")
+	// FlagData is a csv file to process instead of the trials
+	FlagData = flag.String("data", "", "csv file to process instead of the trials, - reads stdin")
+	// FlagPrecision is the number of decimal places of the reported similarities
+	FlagPrecision = flag.Int("precision", -1, "number of decimal places the reported similarities are rounded to, -1 uses the default format")
+	// FlagFailures is the file the seeds of the failed trials are written to
+	FlagFailures = flag.String("failures", "", "file the seeds of the failed trials are written to, - writes to stdout; seed 0 is the -dataset data set")
+	// FlagSeed is the seed of the trial replayed instead of running the trials
+	FlagSeed = flag.Int64("seed", -1, "seed of a trial, as written by -failures, to replay with and without softmax instead of running the trials; 0 is the -dataset data set, negative runs the trials")
+	// FlagDataset is the data set used by the default run
+	FlagDataset = flag.String("dataset", "iris", "data set used by the default run: iris, wine, or random")
+	// FlagN is the number of records of the random data set
+	FlagN = flag.Int("n", 150, "number of records of the random data set")
+	// FlagQuiet suppresses the output
+	FlagQuiet = flag.Bool("q", false, "suppress the output")
+	// FlagAllowed is the number of trials allowed below threshold before the exit status is nonzero
+	FlagAllowed = flag.Int("allowed", 0, "number of trials allowed below threshold before the exit status is nonzero")
+	// FlagMaxN is the maximum number of records of the loaded data set
+	FlagMaxN = flag.Int("maxn", 0, "maximum number of records of the loaded data set, the eigenvalue decomposition is cubic in the number of records; 0 is no cap")
+	// FlagSubsample subsamples a data set over the cap instead of failing
+	FlagSubsample = flag.Bool("subsample", false, "subsample a data set with more than -maxn records to -maxn records instead of failing")
+	// FlagMetrics prints the summary of the trials as prometheus metrics
+	FlagMetrics = flag.Bool("metrics", false, "print the summary of the trials in the prometheus text exposition format instead of the tables")
+	// FlagBootstrap is the number of bootstrap samples of the confidence interval of the similarity
+	FlagBootstrap = flag.Int("bootstrap", 0, "number of bootstrap samples of the 95% confidence interval of the cosine similarity of the data set, 0 disables")
+	// FlagVersion prints the version and exits
+	FlagVersion = flag.Bool("version", false, "print the module, go, and gonum versions and exit")
+	// FlagVerbose writes a log line for each trial to stderr
+	FlagVerbose = flag.Bool("v", false, "write a log line for each trial to stderr, in trial order")
+	// FlagNonFinite is the handling of NaN and Inf measures
+	FlagNonFinite = flag.String("nonfinite", "error", "handling of NaN and Inf measures: none, error, zero, or mean")
 )
 
-func main() {
-	flag.Parse()
+const (
+	// S is the scaling factor for the softmax
+	S = 1.0 - 1e-300
+)
 
-	const (
-		// S is the scaling factor for the softmax
-		S = 1.0 - 1e-300
-	)
+// softmax computes the softmax of the values in place
+func softmax(values []float64) {
+	max := 0.0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	s := max * S
+	sum := 0.0
+	for j, value := range values {
+		values[j] = math.Exp(value - s)
+		sum += values[j]
+	}
+	for j, value := range values {
+		values[j] = value / sum
+	}
+}
 
-	softmax := func(values []float64) {
-		max := 0.0
-		for _, v := range values {
-			if v > max {
-				max = v
-			}
+// argmax returns the index of the maximum value, ties resolve to the lowest index
+func argmax(values []float64) int {
+	index, max := 0, math.Inf(-1)
+	for i, value := range values {
+		if value > max {
+			index, max = i, value
 		}
-		s := max * S
-		sum := 0.0
-		for j, value := range values {
-			values[j] = math.Exp(value - s)
-			sum += values[j]
+	}
+	return index
+}
+
+// TemperatureSchedule computes the softmax temperature of each of the layers, cosine annealed
+// from start at the first layer to end at the last, each is the Config.Temperature of its layer
+func TemperatureSchedule(start, end float64, layers int) []float64 {
+	temperatures := make([]float64, max(layers, 0))
+	for l := range temperatures {
+		progress := 0.0
+		if layers > 1 {
+			progress = float64(l) / float64(layers-1)
 		}
-		for j, value := range values {
-			values[j] = value / sum
+		temperatures[l] = end + (start-end)*(1+math.Cos(math.Pi*progress))/2
+	}
+	return temperatures
+}
+
+// softmaxRows computes the softmax of each row of the matrix divided by the temperature in place,
+// a temperature of zero or one leaves the rows unscaled
+func softmaxRows(m *mat.Dense, temperature float64) {
+	rows, _ := m.Dims()
+	for r := range rows {
+		row := m.RawRowView(r)
+		if temperature != 0 && temperature != 1 {
+			floats.Scale(1/temperature, row)
 		}
+		softmax(row)
 	}
+}
 
-	dot := func(a, b []float64) float64 {
-		x := 0.0
-		for i, value := range a {
-			x += value * b[i]
+// checkRows checks that every row of the matrix sums to 1 within tol
+func checkRows(m *mat.Dense, tol float64) error {
+	rows, _ := m.Dims()
+	for r := range rows {
+		if sum := floats.Sum(m.RawRowView(r)); !(math.Abs(sum-1) <= tol) {
+			return fmt.Errorf("row %d of the attention matrix sums to %v, expected 1", r, sum)
 		}
-		return x
 	}
+	return nil
+}
+
+// dot computes the dot product of two vectors
+func dot(a, b []float64) float64 {
+	x := 0.0
+	for i, value := range a {
+		x += value * b[i]
+	}
+	return x
+}
+
+// abs computes the magnitude of a vector
+func abs(a []float64) float64 {
+	return math.Sqrt(dot(a, a))
+}
+
+// cs computes the cosine similarity of two vectors
+func cs(a, b []float64) float64 {
+	return csEpsilon(a, b, 0)
+}
+
+// csEpsilon computes the cosine similarity of two vectors, a vector with a norm
+// of at most epsilon is treated as zero and has a similarity of 0
+func csEpsilon(a, b []float64, epsilon float64) float64 {
+	ab := dot(a, b)
+	aa := dot(a, a)
+	bb := dot(b, b)
+	if aa <= 0 || math.Sqrt(aa) <= epsilon {
+		return 0
+	}
+	if bb <= 0 || math.Sqrt(bb) <= epsilon {
+		return 0
+	}
+	return ab / (math.Sqrt(aa) * math.Sqrt(bb))
+}
 
-	abs := func(a []float64) float64 {
-		return math.Sqrt(dot(a, a))
+// Matrix converts the data set into a feature matrix
+func Matrix(iris []Fisher) *mat.Dense {
+	width := len(iris[0].Measures)
+	data := make([]float64, 0, width*len(iris))
+	for _, value := range iris {
+		//n := dot(value.Measures, value.Measures)
+		//n = math.Sqrt(n)
+		/*for _, value := range value.Measures {
+			data = append(data, value/n)
+		}*/
+		data = append(data, value.Measures...)
 	}
+	return mat.NewDense(len(iris), width, data)
+}
 
-	cs := func(a, b []float64) float64 {
-		ab := dot(a, b)
-		aa := dot(a, a)
-		bb := dot(b, b)
-		if aa <= 0 {
-			return 0
+// MatrixColumns converts the selected columns of the data set into a feature matrix, no columns selects all
+func MatrixColumns(iris []Fisher, columns []int) *mat.Dense {
+	if len(columns) == 0 {
+		return Matrix(iris)
+	}
+	data := make([]float64, 0, len(columns)*len(iris))
+	for _, value := range iris {
+		for _, column := range columns {
+			data = append(data, value.Measures[column])
 		}
-		if bb <= 0 {
-			return 0
+	}
+	return mat.NewDense(len(iris), len(columns), data)
+}
+
+// Adjacency computes the self attention adjacency matrix of the data set
+func Adjacency(iris []Fisher) *mat.Dense {
+	a := Matrix(iris)
+	adj := mat.NewDense(len(iris), len(iris), nil)
+	adj.Mul(a, a.T())
+	return adj
+}
+
+var (
+	// ErrEigenFailed is returned when the eigenvalue decomposition fails
+	ErrEigenFailed = errors.New("eigenvalue decomposition failed")
+	// ErrPCAFailed is returned when the principal component analysis fails
+	ErrPCAFailed = errors.New("principal component analysis failed")
+)
+
+// AdjacencySlice computes the dot product adjacency matrix of the data set as nested slices,
+// an empty data set has no rows
+func AdjacencySlice(iris []Fisher) [][]float64 {
+	rows := make([][]float64, len(iris))
+	if len(iris) == 0 {
+		return rows
+	}
+	adj := Adjacency(iris)
+	for i := range rows {
+		rows[i] = mat.Row(nil, i, adj)
+	}
+	return rows
+}
+
+// CosineMatrix computes the pairwise cosine similarities of the measures of the data set,
+// an empty data set gives an empty matrix
+func CosineMatrix(iris []Fisher) *mat.Dense {
+	if len(iris) == 0 {
+		return &mat.Dense{}
+	}
+	m := mat.NewDense(len(iris), len(iris), nil)
+	for i := range iris {
+		for j := i; j < len(iris); j++ {
+			similarity := cs(iris[i].Measures, iris[j].Measures)
+			m.Set(i, j, similarity)
+			m.Set(j, i, similarity)
 		}
-		return ab / (math.Sqrt(aa) * math.Sqrt(bb))
 	}
+	return m
+}
+
+// Attention computes the row softmax of the adjacency matrix of the data set
+func Attention(iris []Fisher) *mat.Dense {
+	cp := Adjacency(iris)
+	softmaxRows(cp, 1)
+	return cp
+}
 
-	type Result struct {
-		CosineSimilarity       float64
-		EigenValue             float64
-		MagnitudeEigenvector   float64
-		MagnitudeSelfAttention float64
+// Eigenvectors computes the right eigenvectors of the adjacency matrix,
+// each with its largest magnitude component positive
+func Eigenvectors(iris []Fisher) (*mat.CDense, error) {
+	adj := Adjacency(iris)
+	var eig mat.Eigen
+	ok := eig.Factorize(adj, mat.EigenRight)
+	if !ok {
+		return nil, ErrEigenFailed
 	}
-	process := func(iris []Fisher, sm bool) Result {
-		data := make([]float64, 0, 4*len(iris))
-		for _, value := range iris {
-			//n := dot(value.Measures, value.Measures)
-			//n = math.Sqrt(n)
-			/*for _, value := range value.Measures {
-				data = append(data, value/n)
-			}*/
-			data = append(data, value.Measures...)
-		}
-		// self attention
-		a := mat.NewDense(len(iris), 4, data)
-		adj := mat.NewDense(len(iris), len(iris), nil)
-		adj.Mul(a, a.T())
-		cp := mat.NewDense(len(iris), len(iris), nil)
-		cp.Copy(adj)
-		for r := range len(iris) {
-			row := make([]float64, len(iris))
-			for ii := range row {
-				row[ii] = cp.At(r, ii)
-			}
-			if sm {
-				softmax(row)
+	eigenvectors := mat.NewCDense(len(iris), len(iris), nil)
+	eig.VectorsTo(eigenvectors)
+	fixSigns(eigenvectors)
+	return eigenvectors, nil
+}
+
+// fixSigns rotates each column of the matrix by a unit phase so that its first largest magnitude
+// component is positive real, for real eigenvectors this makes the sign deterministic
+func fixSigns(m *mat.CDense) {
+	rows, cols := m.Dims()
+	for c := range cols {
+		index, max := 0, 0.0
+		for r := range rows {
+			if magnitude := cmplx.Abs(m.At(r, c)); magnitude > max {
+				index, max = r, magnitude
 			}
-			cp.SetRow(r, row)
 		}
-		x := mat.NewDense(len(iris), 4, nil)
-		x.Mul(cp, a)
-		// eigenvector
-		var eig mat.Eigen
-		ok := eig.Factorize(adj, mat.EigenRight)
-		if !ok {
-			panic("Eigenvalue decomposition failed.")
+		if max == 0 {
+			continue
 		}
-		eigenvectors := mat.NewCDense(len(iris), len(iris), nil)
-		eig.VectorsTo(eigenvectors)
-		i, j := make([]float64, 0, len(iris)), make([]float64, 0, len(iris))
+		rotation := cmplx.Conj(m.At(index, c)) / complex(max, 0)
+		for r := range rows {
+			m.Set(r, c, m.At(r, c)*rotation)
+		}
+	}
+}
+
+// byMagnitude returns the indexes of the eigenvalues in descending order of magnitude
+func byMagnitude(values []complex128) []int {
+	order := make([]int, len(values))
+	for c := range order {
+		order[c] = c
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return cmplx.Abs(values[order[a]]) > cmplx.Abs(values[order[b]])
+	})
+	return order
+}
+
+// EigenvectorColumns computes the k right eigenvectors of the adjacency matrix with the largest
+// eigenvalue magnitudes in descending order, each with its largest magnitude component positive.
+// The adjacency matrix a·aᵀ has rank at most d, so for k up to min(n, d) the eigenvectors are the
+// left singular vectors of the n×d feature matrix and neither the n×n adjacency matrix nor its n×n
+// eigenvectors are allocated. Larger k fall back to the full eigenvalue decomposition.
+func EigenvectorColumns(iris []Fisher, k int) (*mat.CDense, error) {
+	if k < 1 || k > len(iris) {
+		return nil, fmt.Errorf("columns %d out of range [1, %d]", k, len(iris))
+	}
+	a := Matrix(iris)
+	if _, width := a.Dims(); k <= width {
+		var svd mat.SVD
+		if !svd.Factorize(a, mat.SVDThinU) {
+			return nil, ErrEigenFailed
+		}
+		var u mat.Dense
+		svd.UTo(&u)
+		columns := mat.NewCDense(len(iris), k, nil)
 		for r := range len(iris) {
-			i = append(i, cmplx.Abs(eigenvectors.At(r, *FlagEigen)))
-			j = append(j, x.At(r, *FlagAttention))
+			for c := range k {
+				columns.Set(r, c, complex(u.At(r, c), 0))
+			}
 		}
-		values := eig.Values(nil)
-		return Result{
-			CosineSimilarity:       cs(i, j),
-			EigenValue:             cmplx.Abs(values[0]),
-			MagnitudeEigenvector:   abs(i),
-			MagnitudeSelfAttention: abs(j),
+		fixSigns(columns)
+		return columns, nil
+	}
+	adj := Adjacency(iris)
+	var eig mat.Eigen
+	if !eig.Factorize(adj, mat.EigenRight) {
+		return nil, ErrEigenFailed
+	}
+	eigenvectors := mat.NewCDense(len(iris), len(iris), nil)
+	eig.VectorsTo(eigenvectors)
+	columns := mat.NewCDense(len(iris), k, nil)
+	for c, index := range byMagnitude(eig.Values(nil))[:k] {
+		for r := range len(iris) {
+			columns.Set(r, c, eigenvectors.At(r, index))
 		}
 	}
+	fixSigns(columns)
+	return columns, nil
+}
 
-	results, iris, count1, count2 := []Result{}, Load(), 0, 0
+// Eigenvalues computes the eigenvalue magnitudes of the adjacency matrix sorted in descending order
+func Eigenvalues(iris []Fisher) ([]float64, error) {
+	if len(iris) == 0 {
+		return nil, errors.New("empty data set")
+	}
+	adj := Adjacency(iris)
+	var eig mat.Eigen
+	ok := eig.Factorize(adj, mat.EigenNone)
+	if !ok {
+		return nil, ErrEigenFailed
+	}
+	values := eig.Values(nil)
+	magnitudes := make([]float64, len(values))
+	for i, value := range values {
+		magnitudes[i] = cmplx.Abs(value)
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(magnitudes)))
+	return magnitudes, nil
+}
 
-	// test with softmax
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
-	fmt.Fprintf(w, "|eigenvalue\t|mag eigenvector\t|mag self attention\t|cosine similarity (with softmax)|\n")
-	fmt.Fprintf(w, "| -----------: \t| -----------: \t| -----------: \t| -----------: \t|\n")
-	result := process(iris, true)
-	if result.CosineSimilarity < .95 {
-		count1++
-	}
-	results = append(results, result)
-	for i := range 128 {
-		iris := Random(int64(i + 1))
-		result := process(iris, true)
-		if result.CosineSimilarity < .95 {
-			count1++
+// SpectralDistance computes the euclidean distance between the sorted eigenvalues of two data sets
+func SpectralDistance(a, b []Fisher) (float64, error) {
+	if len(a) != len(b) {
+		return 0, fmt.Errorf("data sets have different sizes %d and %d", len(a), len(b))
+	}
+	x, err := Eigenvalues(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := Eigenvalues(b)
+	if err != nil {
+		return 0, err
+	}
+	sum := 0.0
+	for i, value := range x {
+		diff := value - y[i]
+		sum += diff * diff
+	}
+	return math.Sqrt(sum), nil
+}
+
+// SpectralGap computes the difference between the two largest eigenvalue magnitudes of the adjacency matrix
+func SpectralGap(iris []Fisher) (float64, error) {
+	values, err := Eigenvalues(iris)
+	if err != nil {
+		return 0, err
+	}
+	if len(values) < 2 {
+		return 0, errors.New("spectral gap requires at least two records")
+	}
+	return values[0] - values[1], nil
+}
+
+// PhaseAlign rotates the complex vector by the conjugate of the phase of its largest magnitude
+// component and returns the real part. For a symmetric matrix the eigenvectors are real up to a
+// global phase, so this recovers a signed real eigenvector.
+func PhaseAlign(vector []complex128) []float64 {
+	index, max := 0, 0.0
+	for i, value := range vector {
+		if magnitude := cmplx.Abs(value); magnitude > max {
+			index, max = i, magnitude
 		}
-		results = append(results, result)
 	}
-	for _, value := range results {
-		fmt.Fprintf(w, "|%f\t|%f\t|%f\t|%f|\n", value.EigenValue, value.MagnitudeEigenvector, value.MagnitudeSelfAttention, value.CosineSimilarity)
+	rotation := complex(1, 0)
+	if max > 0 {
+		rotation = cmplx.Conj(vector[index]) / complex(max, 0)
 	}
-	fmt.Fprintln(w)
+	aligned := make([]float64, len(vector))
+	for i, value := range vector {
+		aligned[i] = real(value * rotation)
+	}
+	return aligned
+}
 
-	// test without softmax
-	results = []Result{}
-	fmt.Fprintf(w, "|eigenvalue\t|mag eigenvector\t|mag self attention\t|cosine similarity (without softmax)|\n")
-	fmt.Fprintf(w, "| -----------: \t| -----------: \t| -----------: \t| -----------: \t|\n")
-	result = process(iris, false)
-	if result.CosineSimilarity < .99 {
-		count2++
-	}
-	results = append(results, result)
-	for i := range 128 {
-		iris := Random(int64(i + 1))
-		result := process(iris, false)
-		if result.CosineSimilarity < .99 {
-			count2++
+// EffectiveRank computes the exponential of the shannon entropy of the normalized eigenvalue magnitudes of the adjacency matrix
+func EffectiveRank(iris []Fisher) (float64, error) {
+	values, err := Eigenvalues(iris)
+	if err != nil {
+		return 0, err
+	}
+	total := floats.Sum(values)
+	if total == 0 {
+		return 0, errors.New("adjacency matrix has no nonzero eigenvalues")
+	}
+	entropy := 0.0
+	for _, value := range values {
+		if p := value / total; p > 0 {
+			entropy -= p * math.Log(p)
 		}
-		results = append(results, result)
 	}
-	for _, value := range results {
-		fmt.Fprintf(w, "|%f\t|%f\t|%f\t|%f|\n", value.EigenValue, value.MagnitudeEigenvector, value.MagnitudeSelfAttention, value.CosineSimilarity)
+	return math.Exp(entropy), nil
+}
+
+// ConditionNumber computes the ratio of the largest to the smallest nonzero eigenvalue magnitude of the
+// adjacency matrix, magnitudes below n·ε times the largest are treated as zero
+func ConditionNumber(iris []Fisher) (float64, error) {
+	values, err := Eigenvalues(iris)
+	if err != nil {
+		return 0, err
+	}
+	if len(values) == 0 || values[0] == 0 {
+		return 0, errors.New("adjacency matrix has no nonzero eigenvalues")
+	}
+	tolerance := float64(len(values)) * (math.Nextafter(1, 2) - 1) * values[0]
+	smallest := values[0]
+	for _, value := range values {
+		if value > tolerance {
+			smallest = value
+		}
+	}
+	return values[0] / smallest, nil
+}
+
+// Symmetrize computes (m + mᵀ)/2 of a square matrix
+func Symmetrize(m mat.Matrix) *mat.SymDense {
+	n, _ := m.Dims()
+	sym := mat.NewSymDense(n, nil)
+	for i := range n {
+		for j := i; j < n; j++ {
+			sym.SetSym(i, j, (m.At(i, j)+m.At(j, i))/2)
+		}
+	}
+	return sym
+}
+
+// Result is the result of processing a data set
+type Result struct {
+	CosineSimilarity       float64
+	EigenValue             float64
+	MagnitudeEigenvector   float64
+	MagnitudeSelfAttention float64
+	// Eigenvalues are the eigenvalues of the adjacency matrix
+	Eigenvalues []complex128
+	// Components is the number of eigenvectors in the aggregate similarity, less than two is a single comparison
+	Components int
+	// Adjacency is the decomposed adjacency matrix, only set by ProcessFull
+	Adjacency *mat.Dense
+	// SelfAttention is the self attention output, only set by ProcessFull
+	SelfAttention *mat.Dense
+	// Similarities compares the eigenvector with the c-th largest eigenvalue magnitude with self attention
+	// output column c, as Components does, for each column up to the smaller of the number of records and
+	// measures, only set by ProcessFull
+	Similarities []float64
+	// Duration is the processing time, only set by ProcessFull
+	Duration time.Duration
+	// Err is the error of a failed trial
+	Err error
+}
+
+// Reference is the signal compared to the self attention output
+type Reference int
+
+const (
+	// ReferenceEigenvector compares against the adjacency matrix eigenvector
+	ReferenceEigenvector Reference = iota
+	// ReferencePCA compares against the projection of the records onto the top principal component
+	ReferencePCA
+)
+
+// MatMul computes the matrix product dst = a·b, dst is already sized to the product.
+// It is an extension point for hardware accelerated implementations. For the adjacency matrix a·aᵀ a
+// custom implementation receives a transposed copy of a, so its results may differ from the default
+// in the last bits even when it computes the same product.
+type MatMul func(dst, a, b *mat.Dense)
+
+// GonumMatMul is the gonum implementation of MatMul, the default; setting it explicitly
+// gives results identical to a nil MatMul
+func GonumMatMul(dst, a, b *mat.Dense) {
+	dst.Mul(a, b)
+}
+
+// Config configures the processing of a data set
+type Config struct {
+	// Softmax applies a softmax to each row of the adjacency matrix before the attention.
+	// When false the raw adjacency matrix multiplies the input, so the attention output is
+	// the input projected onto the adjacency, which is one step of the power iteration for
+	// the principal eigenvector, rather than a weighted average of the input vectors.
+	Softmax bool
+	// Temperature divides each row of the adjacency matrix before the softmax, a high temperature
+	// attends broadly and a low one sharply; zero is the same as one
+	Temperature float64
+	// Eigen is which eigenvector is used
+	Eigen int
+	// Attention is which column of the self attention output is used
+	Attention int
+	// Symmetrize replaces the adjacency matrix with (adj + adjᵀ)/2 so that it is symmetric and is decomposed
+	// with EigenSym, the eigenvectors are then ordered by descending eigenvalue magnitude
+	Symmetrize bool
+	// KNN keeps only the adjacency entries between each record and its KNN most similar other records,
+	// symmetrized, zeroing the rest before the softmax and eigenvalue decomposition; zero keeps all entries.
+	// Every row keeps at least KNN entries, but a hub that is among the nearest of many records keeps
+	// more, with the dot product adjacency of iris one row keeps all n-1 off diagonal entries.
+	KNN int
+	// Columns are the indices of the measures used, empty uses all measures
+	Columns []int
+	// Sphere projects each record onto the sphere of the configured Radius before the attention
+	Sphere bool
+	// Radius is the radius of the sphere used when Sphere is set, it must be positive
+	Radius float64
+	// Weights scales the contribution of each record to the adjacency matrix by scaling its row of the
+	// feature matrix by the square root of its weight, nil weights are uniform
+	Weights []float64
+	// FeatureSpace transposes the feature matrix so the adjacency matrix is the d×d matrix aᵀ·a of the
+	// measures and the self attention and eigenvectors are computed in feature space
+	FeatureSpace bool
+	// Kernel is the kernel the adjacency matrix is built from when Cosine is not set, the zero value is the dot product
+	Kernel Kernel
+	// Cosine builds the adjacency matrix from the pairwise cosine similarities instead of the dot products
+	Cosine bool
+	// DegreeNormalize divides each row of the self attention output by the degree of the record,
+	// the row sum of the adjacency matrix before the softmax
+	DegreeNormalize bool
+	// Residual adds the feature matrix to the self attention output
+	Residual bool
+	// LayerNorm normalizes each row of the self attention output to zero mean and unit variance
+	LayerNorm bool
+	// PhaseAlign uses the signed real eigenvector from PhaseAlign instead of the component magnitudes
+	PhaseAlign bool
+	// Components is the number of eigenvectors, in descending order of eigenvalue magnitude, compared
+	// against the same number of self attention output columns; the cosine similarity is the mean of the
+	// per component similarities. Less than two compares the Eigen eigenvector with the Attention column.
+	Components int
+	// EigenvalueThreshold selects the eigenvectors with an eigenvalue magnitude of at least the threshold
+	// times the largest, up to the number of self attention output columns, for the aggregate similarity
+	// instead of Components; zero disables the selection
+	EigenvalueThreshold float64
+	// WeightByEigenvalue weights the mean of the per component similarities by the eigenvalue magnitudes
+	WeightByEigenvalue bool
+	// Metric is the comparison between the reference signal and the self attention output,
+	// its value is reported in the CosineSimilarity field of the result
+	Metric Metric
+	// Epsilon is the norm at or below which a compared vector is treated as zero by the metric
+	Epsilon float64
+	// Reference is the signal compared to the self attention output
+	Reference Reference
+	// BatchSize partitions the records into contiguous batches that are processed separately by
+	// ProcessMinibatches and ProcessSimilarity, zero is no batching
+	BatchSize int
+	// Workers is the size of the worker pool, zero means GOMAXPROCS
+	Workers int
+	// Retries is the number of times a failed eigenvalue decomposition is retried with a diagonal perturbation
+	Retries int
+	// Jitter is the magnitude of the diagonal perturbation used by the retries
+	Jitter float64
+	// NonFinite is the handling of NaN and Inf measures, with PolicyNone a non finite measure
+	// still fails validation
+	NonFinite Policy
+	// MatMul computes the matrix products of the pipeline, nil uses GonumMatMul; see MatMul for how
+	// the results of a custom implementation may differ
+	MatMul MatMul
+	// Validate checks that the rows of the softmaxed attention matrix sum to 1
+	Validate bool
+	// DiagonalEpsilon is added to the diagonal of the adjacency matrix before the eigenvalue decomposition
+	DiagonalEpsilon float64
+}
+
+// mul computes dst = a·b with the configured matrix multiply
+func (cfg Config) mul(dst, a, b *mat.Dense) {
+	if cfg.MatMul == nil {
+		GonumMatMul(dst, a, b)
+		return
+	}
+	cfg.MatMul(dst, a, b)
+}
+
+// mulT computes dst = a·aᵀ with the configured matrix multiply, the gonum implementation
+// multiplies by the transposed view of a and the others by a transposed copy
+func (cfg Config) mulT(dst, a *mat.Dense) {
+	if cfg.MatMul == nil || reflect.ValueOf(cfg.MatMul).Pointer() == reflect.ValueOf(GonumMatMul).Pointer() {
+		dst.Mul(a, a.T())
+		return
+	}
+	cfg.MatMul(dst, a, mat.DenseCopyOf(a.T()))
+}
+
+// workers returns the number of workers to use for the jobs
+func (cfg Config) workers(jobs int) int {
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return max(min(workers, jobs), 1)
+}
+
+// DefaultConfig returns the default configuration
+func DefaultConfig() Config {
+	return Config{
+		Softmax: true,
+		Radius:  1,
+	}
+}
+
+// project scales each row of the matrix to have a magnitude of radius, zero rows are left unchanged
+func project(a *mat.Dense, radius float64) {
+	n, _ := a.Dims()
+	for r := range n {
+		row := a.RawRowView(r)
+		magnitude := abs(row)
+		if magnitude == 0 {
+			continue
+		}
+		for i := range row {
+			row[i] *= radius / magnitude
+		}
+	}
+}
+
+// layerNorm normalizes the values in place to zero mean and unit variance
+func layerNorm(values []float64) {
+	const epsilon = 1e-5
+	mean, variance := stat.PopMeanVariance(values, nil)
+	scale := 1 / math.Sqrt(variance+epsilon)
+	for i, value := range values {
+		values[i] = (value - mean) * scale
+	}
+}
+
+// features builds the feature matrix of the selected columns of the data set, projected onto the sphere
+// and weighted according to the configuration
+func features(iris []Fisher, cfg Config) *mat.Dense {
+	a := MatrixColumns(iris, cfg.Columns)
+	if cfg.Sphere {
+		project(a, cfg.Radius)
+	}
+	for r, weight := range cfg.Weights {
+		floats.Scale(math.Sqrt(weight), a.RawRowView(r))
+	}
+	return a
+}
+
+// buildAdjacency computes the adjacency matrix of the feature matrix into adj according to the configuration
+func buildAdjacency(adj, a *mat.Dense, cfg Config) {
+	n, _ := a.Dims()
+	if cfg.Cosine {
+		for i := range n {
+			for j := range n {
+				adj.Set(i, j, cs(a.RawRowView(i), a.RawRowView(j)))
+			}
+		}
+	} else if cfg.Kernel.Kind != KernelLinear {
+		for i := range n {
+			for j := range n {
+				adj.Set(i, j, cfg.Kernel.Compute(a.RawRowView(i), a.RawRowView(j)))
+			}
+		}
+	} else {
+		cfg.mulT(adj, a)
+	}
+	if cfg.KNN > 0 {
+		neighbors(adj, cfg.KNN)
+	}
+	if cfg.Symmetrize {
+		adj.Copy(Symmetrize(adj))
+	}
+}
+
+// neighbors keeps the entries of the adjacency matrix between each record and its k most similar other
+// records, in either direction, and zeros the rest including the diagonal
+func neighbors(adj *mat.Dense, k int) {
+	n, _ := adj.Dims()
+	keep := make([]bool, n*n)
+	order := make([]int, 0, n)
+	for i := range n {
+		row := adj.RawRowView(i)
+		order = order[:0]
+		for j := range n {
+			if j != i {
+				order = append(order, j)
+			}
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			return row[order[a]] > row[order[b]]
+		})
+		for _, j := range order[:min(k, len(order))] {
+			keep[i*n+j], keep[j*n+i] = true, true
+		}
+	}
+	for i := range n {
+		row := adj.RawRowView(i)
+		for j := range row {
+			if !keep[i*n+j] {
+				row[j] = 0
+			}
+		}
+	}
+}
+
+// workspace holds the matrices reused between runs of process
+type workspace struct {
+	adj, cp, x   mat.Dense
+	eigenvectors mat.CDense
+}
+
+// newWorkspace allocates a workspace for data sets of up to n records with width measures
+func newWorkspace(n, width int) *workspace {
+	w := &workspace{}
+	w.resize(n, width)
+	return w
+}
+
+// resize resizes the workspace for a data set of n records with width measures,
+// reusing the allocated memory when it is large enough
+func (w *workspace) resize(n, width int) {
+	w.adj.Reset()
+	w.adj.ReuseAs(n, n)
+	w.cp.Reset()
+	w.cp.ReuseAs(n, n)
+	w.x.Reset()
+	w.x.ReuseAs(n, width)
+	w.eigenvectors.Reset()
+	w.eigenvectors.ReuseAs(n, n)
+}
+
+// process computes the self attention of the data set and compares it to the eigenvector
+func process(iris []Fisher, cfg Config) (Result, error) {
+	return new(workspace).process(iris, cfg)
+}
+
+// process computes the self attention of the data set and compares it to the eigenvector using the workspace
+func (w *workspace) process(iris []Fisher, cfg Config) (Result, error) {
+	// self attention
+	a := features(iris, cfg)
+	if cfg.FeatureSpace {
+		a = mat.DenseCopyOf(a.T())
+	}
+	n, width := a.Dims()
+	w.resize(n, width)
+	adj, cp, x := &w.adj, &w.cp, &w.x
+	buildAdjacency(adj, a, cfg)
+	cp.Copy(adj)
+	if cfg.Softmax {
+		softmaxRows(cp, cfg.Temperature)
+		if cfg.Validate {
+			if err := checkRows(cp, 1e-9); err != nil {
+				return Result{}, err
+			}
+		}
+	}
+	cfg.mul(x, cp, a)
+	if cfg.DegreeNormalize {
+		for r := range n {
+			degree := floats.Sum(adj.RawRowView(r))
+			if degree != 0 {
+				floats.Scale(1/degree, x.RawRowView(r))
+			}
+		}
+	}
+	if cfg.Residual {
+		x.Add(x, a)
+	}
+	if cfg.LayerNorm {
+		for r := range n {
+			layerNorm(x.RawRowView(r))
+		}
+	}
+	// eigenvector
+	if cfg.DiagonalEpsilon != 0 {
+		for r := range n {
+			adj.Set(r, r, adj.At(r, r)+cfg.DiagonalEpsilon)
+		}
+	}
+	// the full decomposition is needed here, Eigen indexes the decomposition order, the result reports
+	// all of the eigenvalues, and the configured adjacency is not in general the low rank a·aᵀ
+	// that EigenvectorColumns factors through the singular value decomposition
+	eigenvectors := &w.eigenvectors
+	var values []complex128
+	if cfg.Symmetrize {
+		var err error
+		values, err = eigenSym(eigenvectors, adj, cfg.Retries, cfg.Jitter)
+		if err != nil {
+			return Result{}, err
+		}
+	} else {
+		var eig mat.Eigen
+		if err := factorize(adj, cfg.Retries, cfg.Jitter, func(m *mat.Dense) bool {
+			return eigenFactorize(&eig, m)
+		}); err != nil {
+			return Result{}, err
+		}
+		eig.VectorsTo(eigenvectors)
+		values = eig.Values(nil)
+	}
+	i, j := eigenvector(eigenvectors, cfg.Eigen, cfg.PhaseAlign), mat.Col(nil, cfg.Attention, x)
+	if cfg.Reference == ReferencePCA {
+		var err error
+		i, err = principal(a)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+	similarity := cfg.Metric.CompareEpsilon(i, j, cfg.Epsilon)
+	components := cfg.Components
+	if cfg.Components > 1 || cfg.EigenvalueThreshold > 0 {
+		order := byMagnitude(values)
+		if cfg.EigenvalueThreshold > 0 {
+			components = 0
+			for _, c := range order[:min(len(order), width)] {
+				if cmplx.Abs(values[c]) < cfg.EigenvalueThreshold*cmplx.Abs(values[order[0]]) {
+					break
+				}
+				components++
+			}
+		}
+		similarities, weights := make([]float64, components), make([]float64, components)
+		for c := range components {
+			similarities[c] = cfg.Metric.CompareEpsilon(eigenvector(eigenvectors, order[c], cfg.PhaseAlign), mat.Col(nil, c, x), cfg.Epsilon)
+			weights[c] = 1
+			if cfg.WeightByEigenvalue {
+				weights[c] = cmplx.Abs(values[order[c]])
+			}
+		}
+		similarity = 0
+		if total := floats.Sum(weights); total > 0 {
+			similarity = floats.Dot(similarities, weights) / total
+		}
+	}
+	return Result{
+		CosineSimilarity:       similarity,
+		EigenValue:             cmplx.Abs(values[0]),
+		MagnitudeEigenvector:   abs(i),
+		MagnitudeSelfAttention: abs(j),
+		Eigenvalues:            values,
+		Components:             components,
+	}, nil
+}
+
+// eigenFactorize is the eigenvalue decomposition of the adjacency matrix used by process,
+// it can be replaced to simulate a failing decomposition
+var eigenFactorize = func(eig *mat.Eigen, m *mat.Dense) bool {
+	return eig.Factorize(m, mat.EigenRight)
+}
+
+// factorize computes a decomposition of the matrix with decompose. On failure it retries up to retries
+// times with a random diagonal perturbation in [0, jitter)·I, the perturbation is seeded so it is reproducible.
+func factorize(m *mat.Dense, retries int, jitter float64, decompose func(m *mat.Dense) bool) error {
+	if decompose(m) {
+		return nil
+	}
+	rng := rand.New(rand.NewSource(1))
+	n, _ := m.Dims()
+	perturbed := mat.NewDense(n, n, nil)
+	for range retries {
+		perturbed.Copy(m)
+		epsilon := jitter * rng.Float64()
+		for r := range n {
+			perturbed.Set(r, r, perturbed.At(r, r)+epsilon)
+		}
+		if decompose(perturbed) {
+			return nil
+		}
+	}
+	return ErrEigenFailed
+}
+
+// eigenSym computes the eigenvalue decomposition of the symmetric matrix m with EigenSym.
+// The eigenvectors are stored in eigenvectors and the eigenvalues returned in descending
+// order of magnitude, so the columns line up with the values as they do for Eigen
+func eigenSym(eigenvectors *mat.CDense, m *mat.Dense, retries int, jitter float64) ([]complex128, error) {
+	var eig mat.EigenSym
+	if err := factorize(m, retries, jitter, func(m *mat.Dense) bool {
+		return eig.Factorize(Symmetrize(m), true)
+	}); err != nil {
+		return nil, err
+	}
+	var vectors mat.Dense
+	eig.VectorsTo(&vectors)
+	eigenvalues := eig.Values(nil)
+	values := make([]complex128, len(eigenvalues))
+	for c, v := range eigenvalues {
+		values[c] = complex(v, 0)
+	}
+	order := byMagnitude(values)
+	n, _ := vectors.Dims()
+	if eigenvectors.IsEmpty() {
+		eigenvectors.ReuseAs(n, n)
+	}
+	sorted := make([]complex128, len(values))
+	for c, k := range order {
+		sorted[c] = values[k]
+		for r := range n {
+			eigenvectors.Set(r, c, complex(vectors.At(r, k), 0))
+		}
+	}
+	return sorted, nil
+}
+
+// eigenvector returns the component magnitudes of the eigenvector in column c,
+// or the signed real eigenvector from PhaseAlign if phaseAlign is set
+func eigenvector(eigenvectors *mat.CDense, c int, phaseAlign bool) []float64 {
+	n, _ := eigenvectors.Dims()
+	if phaseAlign {
+		vector := make([]complex128, n)
+		for r := range vector {
+			vector[r] = eigenvectors.At(r, c)
+		}
+		return PhaseAlign(vector)
+	}
+	vector := make([]float64, n)
+	for r := range vector {
+		vector[r] = cmplx.Abs(eigenvectors.At(r, c))
+	}
+	return vector
+}
+
+// principal projects the rows of the matrix onto its top principal component,
+// the sign is chosen so that the projections sum to a nonnegative value
+func principal(a *mat.Dense) ([]float64, error) {
+	var pc stat.PC
+	ok := pc.PrincipalComponents(a, nil)
+	if !ok {
+		return nil, ErrPCAFailed
+	}
+	var vectors mat.Dense
+	pc.VectorsTo(&vectors)
+	n, _ := a.Dims()
+	projection := mat.NewVecDense(n, nil)
+	projection.MulVec(a, vectors.ColView(0))
+	scores := projection.RawVector().Data
+	if floats.Sum(scores) < 0 {
+		floats.Scale(-1, scores)
+	}
+	return scores, nil
+}
+
+// validate checks that the data set can be processed with the configuration
+func validate(iris []Fisher, cfg Config) error {
+	if len(iris) == 0 {
+		return errors.New("empty data set")
+	}
+	width := len(iris[0].Measures)
+	if width == 0 {
+		return errors.New("records have no measures")
+	}
+	for i, value := range iris {
+		if len(value.Measures) != width {
+			return fmt.Errorf("record %d has %d measures, expected %d", i, len(value.Measures), width)
+		}
+		// a non finite measure makes the eigenvalue decomposition loop forever
+		for ii, measure := range value.Measures {
+			if math.IsNaN(measure) || math.IsInf(measure, 0) {
+				return fmt.Errorf("record %d measure %d is %v, expected a finite measure", i, ii, measure)
+			}
+		}
+	}
+	for _, column := range cfg.Columns {
+		if column < 0 || column >= width {
+			return fmt.Errorf("column %d out of range [0, %d)", column, width)
+		}
+	}
+	if len(cfg.Columns) > 0 {
+		width = len(cfg.Columns)
+	}
+	if cfg.Weights != nil && len(cfg.Weights) != len(iris) {
+		return fmt.Errorf("%d weights for %d records", len(cfg.Weights), len(iris))
+	}
+	for i, weight := range cfg.Weights {
+		if weight < 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+			return fmt.Errorf("weight %d is %v, expected a finite non negative weight", i, weight)
+		}
+	}
+	if cfg.Sphere && !(cfg.Radius > 0) {
+		return fmt.Errorf("sphere radius %v, expected a positive radius", cfg.Radius)
+	}
+	if cfg.Temperature < 0 || math.IsNaN(cfg.Temperature) || math.IsInf(cfg.Temperature, 0) {
+		return fmt.Errorf("temperature %v, expected a finite non negative temperature", cfg.Temperature)
+	}
+	if cfg.Kernel.Gamma < 0 {
+		return fmt.Errorf("kernel gamma %v is negative", cfg.Kernel.Gamma)
+	}
+	if cfg.Kernel.Kind == KernelPolynomial && cfg.Kernel.Degree < 1 {
+		return fmt.Errorf("polynomial kernel degree %d is less than 1", cfg.Kernel.Degree)
+	}
+	n := len(iris)
+	if cfg.FeatureSpace {
+		n, width = width, n
+	}
+	if cfg.Eigen < 0 || cfg.Eigen >= n {
+		return fmt.Errorf("eigenvector %d out of range [0, %d)", cfg.Eigen, n)
+	}
+	if cfg.EigenvalueThreshold < 0 || cfg.EigenvalueThreshold > 1 {
+		return fmt.Errorf("eigenvalue threshold %v out of range [0, 1]", cfg.EigenvalueThreshold)
+	}
+	if cfg.Components > min(n, width) {
+		return fmt.Errorf("components %d exceeds %d", cfg.Components, min(n, width))
+	}
+	if cfg.Attention < 0 || cfg.Attention >= width {
+		return fmt.Errorf("attention column %d out of range [0, %d)", cfg.Attention, width)
+	}
+	return nil
+}
+
+// prepare sanitizes and validates the data set according to the configuration
+func prepare(iris []Fisher, cfg Config) ([]Fisher, error) {
+	iris, err := Sanitize(iris, cfg.NonFinite)
+	if err != nil {
+		return nil, err
+	}
+	return iris, validate(iris, cfg)
+}
+
+// ProcessSimilarity computes the cosine similarity between the eigenvector and the self attention of the data set,
+// with a BatchSize it is the mean of the similarities of the batches weighted by their number of records
+func ProcessSimilarity(iris []Fisher, cfg Config) (float64, error) {
+	if cfg.BatchSize > 0 {
+		similarities, err := ProcessMinibatches(iris, cfg)
+		if err != nil {
+			return 0, err
+		}
+		weights := make([]float64, len(similarities))
+		for i, batch := range minibatches(iris, cfg.BatchSize) {
+			weights[i] = float64(len(batch))
+		}
+		return stat.Mean(similarities, weights), nil
+	}
+	iris, err := prepare(iris, cfg)
+	if err != nil {
+		return 0, err
+	}
+	result, err := process(iris, cfg)
+	return result.CosineSimilarity, err
+}
+
+// ProcessFull processes the data set and returns the result along with the adjacency matrix,
+// the self attention output, the per column similarities, and the processing time
+func ProcessFull(iris []Fisher, cfg Config) (*Result, error) {
+	iris, err := prepare(iris, cfg)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	w := new(workspace)
+	result, err := w.process(iris, cfg)
+	if err != nil {
+		return nil, err
+	}
+	result.Duration = time.Since(start)
+	result.Adjacency, result.SelfAttention = &w.adj, &w.x
+	n, width := w.x.Dims()
+	result.Similarities = make([]float64, min(n, width))
+	order := byMagnitude(result.Eigenvalues)
+	for c := range result.Similarities {
+		result.Similarities[c] = cfg.Metric.CompareEpsilon(eigenvector(&w.eigenvectors, order[c], cfg.PhaseAlign), mat.Col(nil, c, &w.x), cfg.Epsilon)
+	}
+	return &result, nil
+}
+
+// ProcessBatch computes the cosine similarity of each data set on a pool of workers,
+// each reusing a workspace sized for the largest data set
+func ProcessBatch(datasets [][]Fisher, cfg Config) ([]float64, error) {
+	n, width := 0, 0
+	prepared := make([][]Fisher, len(datasets))
+	for i, iris := range datasets {
+		iris, err := prepare(iris, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("data set %d: %w", i, err)
+		}
+		prepared[i] = iris
+		n, width = max(n, len(iris)), max(width, len(iris[0].Measures))
+	}
+	datasets = prepared
+	similarities := make([]float64, len(datasets))
+	if len(datasets) == 0 {
+		return similarities, nil
+	}
+	jobs := make(chan int, len(datasets))
+	for i := range datasets {
+		jobs <- i
+	}
+	close(jobs)
+	var wg sync.WaitGroup
+	errs := make([]error, len(datasets))
+	for range cfg.workers(len(datasets)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := newWorkspace(n, width)
+			for i := range jobs {
+				var result Result
+				result, errs[i] = w.process(datasets[i], cfg)
+				similarities[i] = result.CosineSimilarity
+			}
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("data set %d: %w", i, err)
+		}
+	}
+	return similarities, nil
+}
+
+// minibatches partitions the data set into contiguous batches of size records, the last batch holding
+// the remainder; a remainder of a single record, which would trivially score 1, joins the previous batch
+func minibatches(iris []Fisher, size int) [][]Fisher {
+	batches := make([][]Fisher, 0, (len(iris)+size-1)/size)
+	for i := 0; i < len(iris); {
+		end := min(i+size, len(iris))
+		if len(iris)-end < 2 {
+			end = len(iris)
+		}
+		batches = append(batches, iris[i:end])
+		i = end
+	}
+	return batches
+}
+
+// ProcessMinibatches partitions the data set into contiguous batches of BatchSize records, the last
+// batch holding the remainder, and computes the cosine similarity of each batch on a pool of workers.
+// The records only attend within their batch. A remainder of a single record joins the previous batch.
+func ProcessMinibatches(iris []Fisher, cfg Config) ([]float64, error) {
+	if cfg.BatchSize <= 0 {
+		return nil, fmt.Errorf("batch size %d is not positive", cfg.BatchSize)
+	}
+	if cfg.Weights != nil {
+		return nil, errors.New("weights are not supported with batches")
+	}
+	batches := minibatches(iris, cfg.BatchSize)
+	if len(batches) == 0 {
+		return nil, errors.New("empty data set")
+	}
+	cfg.BatchSize = 0
+	return ProcessBatch(batches, cfg)
+}
+
+// RandomBaseline computes the mean and standard deviation of the cosine similarity over random data sets
+func RandomBaseline(seeds []int64, cfg Config) (mean, std float64, err error) {
+	if len(seeds) == 0 {
+		return 0, 0, errors.New("no seeds")
+	}
+	datasets := make([][]Fisher, 0, len(seeds))
+	for _, seed := range seeds {
+		datasets = append(datasets, Random(seed))
+	}
+	similarities, err := ProcessBatch(datasets, cfg)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(similarities) == 1 {
+		return similarities[0], 0, nil
+	}
+	mean, std = stat.MeanStdDev(similarities, nil)
+	return mean, std, nil
+}
+
+// maxPrecision is the number of decimal places beyond which rounding a float64 has no effect
+const maxPrecision = 17
+
+// Round rounds the value to precision decimal places, the precision is clamped to ±maxPrecision
+func Round(value float64, precision int) float64 {
+	precision = max(min(precision, maxPrecision), -maxPrecision)
+	scale := math.Pow(10, float64(precision))
+	return math.Round(value*scale) / scale
+}
+
+// formatSimilarity formats a reported similarity with the precision set by the precision flag,
+// at most maxPrecision decimal places
+func formatSimilarity(value float64) string {
+	if *FlagPrecision < 0 {
+		return fmt.Sprintf("%f", value)
+	}
+	precision := min(*FlagPrecision, maxPrecision)
+	return strconv.FormatFloat(Round(value, precision), 'f', precision, 64)
+}
+
+// EMA is an exponential moving average
+type EMA struct {
+	// Alpha is the weight of a new value
+	Alpha float64
+	// Value is the current average
+	Value float64
+	// Count is the number of values seen
+	Count int
+}
+
+// Update adds the value to the average and returns the new average, the first value initializes the average
+func (e *EMA) Update(value float64) float64 {
+	if e.Count == 0 {
+		e.Value = value
+	} else {
+		e.Value = e.Alpha*value + (1-e.Alpha)*e.Value
+	}
+	e.Count++
+	return e.Value
+}
+
+// capSize enforces the maximum number of records of the data set, a data set over the cap is
+// subsampled to maxn records if subsample is set and is otherwise an error. A warning is written to warn.
+func capSize(iris []Fisher, maxn int, subsample bool, warn io.Writer) ([]Fisher, error) {
+	if maxn <= 0 || len(iris) <= maxn {
+		return iris, nil
+	}
+	if !subsample {
+		return nil, fmt.Errorf("data set has %d records, more than -maxn %d; the adjacency matrix is quadratic and the eigenvalue decomposition cubic in the number of records", len(iris), maxn)
+	}
+	fmt.Fprintf(warn, "warning: subsampling %d records to %d, the adjacency matrix is quadratic and the eigenvalue decomposition cubic in the number of records\n", len(iris), maxn)
+	return Subsample(iris, maxn, 1), nil
+}
+
+// orderedLog buffers log lines written out of order by concurrent trials and
+// writes them in trial order, a line is written once all of the earlier trials are written
+type orderedLog struct {
+	w       io.Writer
+	next    int
+	pending map[int]string
+}
+
+// newOrderedLog creates an ordered log writing to w
+func newOrderedLog(w io.Writer) *orderedLog {
+	return &orderedLog{w: w, pending: make(map[int]string)}
+}
+
+// Add adds the log line of the trial and writes the lines that are now in order
+func (l *orderedLog) Add(trial int, line string) {
+	l.pending[trial] = line
+	for {
+		line, ok := l.pending[l.next]
+		if !ok {
+			return
+		}
+		delete(l.pending, l.next)
+		fmt.Fprintln(l.w, line)
+		l.next++
+	}
+}
+
+// threshold is the cosine similarity threshold of the trials with or without softmax
+func threshold(softmax bool) float64 {
+	if softmax {
+		return .95
+	}
+	return .99
+}
+
+// Failure is a trial below the cosine similarity threshold
+type Failure struct {
+	// Seed is the seed of the random data set, zero is the data set of the trials
+	Seed int64
+	// Softmax is whether the trial used softmax
+	Softmax bool
+}
+
+// String formats the failure as the seed and the softmax mode separated by a tab
+func (f Failure) String() string {
+	mode := "with softmax"
+	if !f.Softmax {
+		mode = "without softmax"
+	}
+	return fmt.Sprintf("%d\t%s", f.Seed, mode)
+}
+
+// run runs the trials with and without softmax, writes the summary to out, and returns the trials
+// below the cosine similarity threshold. If alpha is positive the exponential moving average of the
+// cosine similarity is written to stderr as the trials complete. If verbose is not nil a log line for
+// each trial is written to it in trial order. If metrics is not nil the summary is also written to it
+// as prometheus metrics.
+func run(out io.Writer, iris []Fisher, cfg Config, alpha float64, verbose, metrics io.Writer) []Failure {
+	count1, count2 := 0, 0
+	sum1, sum2, n1, n2 := 0.0, 0.0, 0, 0
+	failures := []Failure{}
+	observe := func(name string) func(done, total, trial int, result Result) {
+		if alpha <= 0 && verbose == nil {
+			return nil
+		}
+		ema := EMA{Alpha: alpha}
+		var log *orderedLog
+		if verbose != nil {
+			log = newOrderedLog(verbose)
+		}
+		return func(done, total, trial int, result Result) {
+			if alpha > 0 {
+				fmt.Fprintf(os.Stderr, "%d/%d ema %s (%s)\n", done, total, formatSimilarity(ema.Update(result.CosineSimilarity)), name)
+			}
+			if log != nil {
+				line := fmt.Sprintf("trial %d: eigenvalue %f cosine similarity %s (%s)", trial, result.EigenValue, formatSimilarity(result.CosineSimilarity), name)
+				if result.Err != nil {
+					line = fmt.Sprintf("trial %d: %v (%s)", trial, result.Err, name)
+				}
+				log.Add(trial, line)
+			}
+		}
+	}
+
+	// test with softmax
+	w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(w, "|eigenvalue\t|mag eigenvector\t|mag self attention\t|cosine similarity (with softmax)|\n")
+	fmt.Fprintf(w, "| -----------: \t| -----------: \t| -----------: \t| -----------: \t|\n")
+	cfg.Softmax = true
+	results := runTrials(iris, 128, cfg, observe("with softmax"))
+	for i, value := range results {
+		if value.Err != nil {
+			fmt.Fprintf(os.Stderr, "trial %d: %v\n", i, value.Err)
+			count1++
+			failures = append(failures, Failure{Seed: int64(i), Softmax: true})
+			continue
+		}
+		if cfg.Metric.Fails(value.CosineSimilarity, threshold(true)) {
+			count1++
+			failures = append(failures, Failure{Seed: int64(i), Softmax: true})
+		}
+		sum1, n1 = sum1+value.CosineSimilarity, n1+1
+		fmt.Fprintf(w, "|%f\t|%f\t|%f\t|%s|\n", value.EigenValue, value.MagnitudeEigenvector, value.MagnitudeSelfAttention, formatSimilarity(value.CosineSimilarity))
+	}
+	fmt.Fprintln(w)
+
+	// test without softmax
+	fmt.Fprintf(w, "|eigenvalue\t|mag eigenvector\t|mag self attention\t|cosine similarity (without softmax)|\n")
+	fmt.Fprintf(w, "| -----------: \t| -----------: \t| -----------: \t| -----------: \t|\n")
+	cfg.Softmax = false
+	results = runTrials(iris, 128, cfg, observe("without softmax"))
+	for i, value := range results {
+		if value.Err != nil {
+			fmt.Fprintf(os.Stderr, "trial %d: %v\n", i, value.Err)
+			count2++
+			failures = append(failures, Failure{Seed: int64(i)})
+			continue
+		}
+		if cfg.Metric.Fails(value.CosineSimilarity, threshold(false)) {
+			count2++
+			failures = append(failures, Failure{Seed: int64(i)})
+		}
+		sum2, n2 = sum2+value.CosineSimilarity, n2+1
+		fmt.Fprintf(w, "|%f\t|%f\t|%f\t|%s|\n", value.EigenValue, value.MagnitudeEigenvector, value.MagnitudeSelfAttention, formatSimilarity(value.CosineSimilarity))
+	}
+	w.Flush()
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "%d/129 outside of cosine similarity of .95 (with softmax)\n", count1)
+	fmt.Fprintf(out, "%d/129 outside of cosine similarity of .99 (without softmax)\n", count2)
+	if metrics != nil {
+		writeMetrics(metrics, []summary{
+			{softmax: true, trials: len(results), below: count1, mean: sum1 / float64(max(n1, 1))},
+			{softmax: false, trials: len(results), below: count2, mean: sum2 / float64(max(n2, 1))},
+		})
+	}
+	return failures
+}
+
+// replay processes the data set of the trial with the seed with and without softmax, writes the results to
+// out, and returns the modes below the cosine similarity threshold as failures of the trial
+func replay(out io.Writer, iris []Fisher, seed int64, cfg Config) ([]Failure, error) {
+	if seed < 0 {
+		return nil, fmt.Errorf("seed %d is negative", seed)
+	}
+	data := trialData(iris, seed)
+	failures := []Failure{}
+	w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(w, "|seed\t|softmax\t|eigenvalue\t|mag eigenvector\t|mag self attention\t|cosine similarity|\n")
+	fmt.Fprintf(w, "| -----------: \t| -----------: \t| -----------: \t| -----------: \t| -----------: \t| -----------: \t|\n")
+	for _, softmax := range []bool{true, false} {
+		cfg.Softmax = softmax
+		if err := validate(data, cfg); err != nil {
+			return nil, err
+		}
+		result, err := process(data, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Metric.Fails(result.CosineSimilarity, threshold(softmax)) {
+			failures = append(failures, Failure{Seed: seed, Softmax: softmax})
+		}
+		fmt.Fprintf(w, "|%d\t|%t\t|%f\t|%f\t|%f\t|%s|\n", seed, softmax, result.EigenValue, result.MagnitudeEigenvector, result.MagnitudeSelfAttention, formatSimilarity(result.CosineSimilarity))
+	}
+	return failures, w.Flush()
+}
+
+// summary is the summary of the trials of one mode
+type summary struct {
+	softmax bool
+	trials  int
+	below   int
+	mean    float64
+}
+
+// writeMetrics writes the summaries in the prometheus text exposition format
+func writeMetrics(w io.Writer, summaries []summary) {
+	metrics := []struct {
+		name, kind, help string
+		value            func(summary) string
+	}{
+		{"lemma_trials_total", "counter", "Number of trials run.", func(s summary) string {
+			return strconv.Itoa(s.trials)
+		}},
+		{"lemma_below_threshold_total", "counter", "Number of trials outside of the cosine similarity threshold.", func(s summary) string {
+			return strconv.Itoa(s.below)
+		}},
+		{"lemma_mean_similarity", "gauge", "Mean cosine similarity of the successful trials.", func(s summary) string {
+			return formatSimilarity(s.mean)
+		}},
+	}
+	for _, metric := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", metric.name, metric.kind)
+		for _, s := range summaries {
+			fmt.Fprintf(w, "%s{softmax=\"%t\"} %s\n", metric.name, s.softmax, metric.value(s))
+		}
+	}
+}
+
+// printBootstrap prints the cosine similarity of the data set and its 95% percentile interval over b bootstrap samples,
+// in the prometheus text exposition format if metrics is set
+func printBootstrap(out io.Writer, iris []Fisher, cfg Config, b int, metrics bool) error {
+	similarity, err := ProcessSimilarity(iris, cfg)
+	if err != nil {
+		return err
+	}
+	_, lo, hi, err := BootstrapSimilarity(iris, b, 1, cfg)
+	if err != nil {
+		return err
+	}
+	if metrics {
+		fmt.Fprintf(out, "# HELP lemma_bootstrap_similarity Cosine similarity of the data set and its 95%% percentile interval over %d bootstrap samples.\n", b)
+		fmt.Fprintf(out, "# TYPE lemma_bootstrap_similarity gauge\n")
+		fmt.Fprintf(out, "lemma_bootstrap_similarity{bound=\"estimate\"} %s\n", formatSimilarity(similarity))
+		fmt.Fprintf(out, "lemma_bootstrap_similarity{bound=\"lo\"} %s\n", formatSimilarity(lo))
+		fmt.Fprintf(out, "lemma_bootstrap_similarity{bound=\"hi\"} %s\n", formatSimilarity(hi))
+		return nil
+	}
+	fmt.Fprintf(out, "\ncosine similarity %s [%s, %s] over %d bootstrap samples\n", formatSimilarity(similarity), formatSimilarity(lo), formatSimilarity(hi), b)
+	return nil
+}
+
+// Version describes the module version, the go version, and the gonum version of the build
+func Version() string {
+	module, gonum := "unknown", "unknown"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		module = info.Main.Version
+		for _, dep := range info.Deps {
+			if dep.Path == "gonum.org/v1/gonum" {
+				gonum = dep.Version
+				if dep.Replace != nil {
+					gonum = dep.Replace.Version
+				}
+			}
+		}
+	}
+	return fmt.Sprintf("lemma %s %s gonum %s", module, runtime.Version(), gonum)
+}
+
+// writeFailures writes the failed trials one per line to the file at path, a path of "-" writes to stdout
+func writeFailures(path string, failures []Failure) error {
+	out := io.Writer(os.Stdout)
+	if path != "-" {
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	for _, failure := range failures {
+		if _, err := fmt.Fprintln(out, failure.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func main() {
+	flag.Parse()
+
+	if *FlagVersion {
+		fmt.Println(Version())
+		return
+	}
+
+	if flag.NArg() > 0 {
+		command, ok := Commands[flag.Arg(0)]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n", flag.Arg(0))
+			os.Exit(2)
+		}
+		if err := command(flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	cfg, err := flagConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	out := io.Writer(os.Stdout)
+	if *FlagQuiet {
+		out = io.Discard
+	}
+	failures := 0
+	if *FlagData != "" {
+		iris, err := LoadFile(*FlagData)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		iris, err = capSize(iris, *FlagMaxN, *FlagSubsample, os.Stderr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		result, err := ProcessFull(iris, cfg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := printResult(out, *result); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if *FlagBootstrap > 0 {
+			if err := printBootstrap(out, iris, cfg, *FlagBootstrap, false); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		if cfg.Metric.Fails(result.CosineSimilarity, .95) {
+			failures++
+		}
+	} else {
+		iris, err := LoadDataset(*FlagDataset, *FlagN)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		iris, err = capSize(iris, *FlagMaxN, *FlagSubsample, os.Stderr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		iris, err = prepare(iris, cfg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if *FlagSeed >= 0 {
+			trials, err := replay(out, iris, *FlagSeed, cfg)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			if len(trials) > *FlagAllowed {
+				os.Exit(1)
+			}
+			return
+		}
+		var verbose io.Writer
+		if *FlagVerbose {
+			verbose = os.Stderr
+		}
+		var metrics io.Writer
+		if *FlagMetrics && !*FlagQuiet {
+			out, metrics = io.Discard, os.Stdout
+		}
+		trials := run(out, iris, cfg, *FlagEMA, verbose, metrics)
+		if *FlagBootstrap > 0 {
+			report := out
+			if metrics != nil {
+				report = metrics
+			}
+			if err := printBootstrap(report, iris, cfg, *FlagBootstrap, metrics != nil); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		if *FlagFailures != "" {
+			if err := writeFailures(*FlagFailures, trials); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		failures = len(trials)
+	}
+	if failures > *FlagAllowed {
+		os.Exit(1)
 	}
-	w.Flush()
-	fmt.Println()
-	fmt.Printf("%d/129 outside of cosine similarity of .95 (with softmax)\n", count1)
-	fmt.Printf("%d/129 outside of cosine similarity of .99 (without softmax)\n", count2)
 }
@@ -0,0 +1,1841 @@
+// Copyright 2025 The Lemma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"math/cmplx"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat"
+)
+
+// TestRandomGolden checks the first records of Random(1) against checked in values, the trial results
+// depend on this sequence so a change to the random number usage must update them deliberately
+func TestRandomGolden(t *testing.T) {
+	golden := [][]float64{
+		{0.6046602879796196, 0.9405090880450124, 0.6645600532184904, 0.4377141871869802},
+		{0.4246374970712657, 0.6868230728671094, 0.06563701921747622, 0.15651925473279124},
+		{0.09696951891448456, 0.30091186058528707, 0.5152126285020654, 0.8136399609900968},
+	}
+	iris := Random(1)
+	if len(iris) != 150 {
+		t.Fatalf("got %d records, expected 150", len(iris))
+	}
+	for i, measures := range golden {
+		if len(iris[i].Measures) != len(measures) {
+			t.Fatalf("record %d has %d measures, expected %d", i, len(iris[i].Measures), len(measures))
+		}
+		for j, value := range measures {
+			if iris[i].Measures[j] != value {
+				t.Fatalf("record %d measure %d is %v, expected %v", i, j, iris[i].Measures[j], value)
+			}
+		}
+	}
+}
+
+// irisData reads the raw iris.data csv from the embedded iris.zip
+func irisData(t *testing.T) []byte {
+	t.Helper()
+	data, err := fs.ReadFile(DataFS, "iris.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := reader.Open("iris.data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	csv, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return csv
+}
+
+// failFS is a file system whose Open always fails
+type failFS struct{}
+
+func (failFS) Open(name string) (fs.File, error) {
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+}
+
+func TestBuildLabelMapSorted(t *testing.T) {
+	iris := Load()
+	ids, labels := BuildLabelMapSorted(iris)
+	if !reflect.DeepEqual(labels, Inverse[:]) {
+		t.Fatalf("got labels %v, expected %v", labels, Inverse)
+	}
+	for label, id := range Labels {
+		if ids[label] != id {
+			t.Fatalf("label %s has id %d, expected %d", label, ids[label], id)
+		}
+	}
+	// reversing the records reverses the first seen order but not the sorted ids
+	for i, j := 0, len(iris)-1; i < j; i, j = i+1, j-1 {
+		iris[i], iris[j] = iris[j], iris[i]
+	}
+	if _, seen := BuildLabelMap(iris); seen[0] != "Iris-virginica" {
+		t.Fatalf("got first seen label %s, expected Iris-virginica", seen[0])
+	}
+	reversedIDs, reversed := BuildLabelMapSorted(iris)
+	if !reflect.DeepEqual(reversedIDs, ids) || !reflect.DeepEqual(reversed, labels) {
+		t.Fatalf("got %v and %v for the reversed records, expected %v and %v", reversedIDs, reversed, ids, labels)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	iris := Load()
+	fingerprint := Fingerprint(iris)
+	if len(fingerprint) != 64 {
+		t.Fatalf("got fingerprint %q, expected a sha-256 hex digest", fingerprint)
+	}
+	if Fingerprint(Load()) != fingerprint {
+		t.Fatal("equal data sets have different fingerprints")
+	}
+	// the index and cluster are not part of the fingerprint
+	iris[0].Index, iris[0].Cluster = 7, 2
+	if Fingerprint(iris) != fingerprint {
+		t.Fatal("the index or cluster changed the fingerprint")
+	}
+	iris[0], iris[1] = iris[1], iris[0]
+	if Fingerprint(iris) == fingerprint {
+		t.Fatal("permuted records have the same fingerprint")
+	}
+	// the measures and labels are delimited
+	a := []Fisher{{Measures: []float64{1}, Label: "ab"}}
+	b := []Fisher{{Measures: []float64{1}, Label: "a"}, {Label: "b"}}
+	if Fingerprint(a) == Fingerprint(b) {
+		t.Fatal("different records have the same fingerprint")
+	}
+}
+
+func TestDataFS(t *testing.T) {
+	if _, err := LoadFS(failFS{}); !errors.Is(err, fs.ErrPermission) {
+		t.Fatalf("got error %v, expected %v", err, fs.ErrPermission)
+	}
+	if _, err := LoadFS(fstest.MapFS{}); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got error %v, expected %v", err, fs.ErrNotExist)
+	}
+	data, err := fs.ReadFile(Iris, "iris.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	iris, err := LoadFS(fstest.MapFS{"iris.zip": {Data: data}})
+	if err != nil || len(iris) != 150 {
+		t.Fatalf("got %d records, %v, expected the 150 iris records", len(iris), err)
+	}
+	// Load reads DataFS and panics when it fails
+	original := DataFS
+	defer func() {
+		DataFS = original
+		if recover() == nil {
+			t.Fatal("expected Load to panic")
+		}
+	}()
+	DataFS = failFS{}
+	Load()
+}
+
+func TestLoadReader(t *testing.T) {
+	data := irisData(t)
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make([]Fisher, 0, len(records))
+	for i, record := range records {
+		value := Fisher{Label: record[len(record)-1], Index: i}
+		for _, field := range record[:len(record)-1] {
+			f, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			value.Measures = append(value.Measures, f)
+		}
+		want = append(want, value)
+	}
+	iris, err := LoadReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(iris) != 150 || !reflect.DeepEqual(iris, want) {
+		t.Fatalf("got %d records, expected the %d records of csv.ReadAll", len(iris), len(want))
+	}
+	if !reflect.DeepEqual(Load(), want) {
+		t.Fatal("Load differs from csv.ReadAll")
+	}
+}
+
+func TestLoadIter(t *testing.T) {
+	data := irisData(t)
+	want, err := LoadReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := LoadIter(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var iris []Fisher
+	for {
+		record, ok, err := next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		iris = append(iris, record)
+	}
+	if !reflect.DeepEqual(iris, want) {
+		t.Fatalf("got %d records, expected the %d records of LoadReader in order", len(iris), len(want))
+	}
+	if _, ok, err := next(); ok || err != nil {
+		t.Fatalf("got %v, %v after the last record, expected false and no error", ok, err)
+	}
+	next, err = LoadIter(strings.NewReader("1,2,a\nx,2,b\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := next(); !ok || err != nil {
+		t.Fatalf("got %v, %v for the first record, expected true and no error", ok, err)
+	}
+	if _, _, err := next(); err == nil {
+		t.Fatal("expected an error for a non numeric measure")
+	}
+}
+
+func TestLoadReaderColumn(t *testing.T) {
+	iris, err := LoadReaderColumn(strings.NewReader("a,1,2\nb,3,4\n"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Fisher{
+		{Label: "a", Measures: []float64{1, 2}, Index: 0},
+		{Label: "b", Measures: []float64{3, 4}, Index: 1},
+	}
+	if !reflect.DeepEqual(iris, want) {
+		t.Fatalf("got %+v, expected %+v", iris, want)
+	}
+	// -3 is the first of three columns
+	if iris, err := LoadReaderColumn(strings.NewReader("a,1,2\nb,3,4\n"), -3); err != nil || !reflect.DeepEqual(iris, want) {
+		t.Fatalf("got %+v, %v for column -3, expected %+v", iris, err, want)
+	}
+	for _, label := range []int{3, -4} {
+		if _, err := LoadReaderColumn(strings.NewReader("a,1,2\n"), label); err == nil {
+			t.Fatalf("expected an error for label column %d", label)
+		}
+	}
+}
+
+func TestLoadMany(t *testing.T) {
+	dir := t.TempDir()
+	iris := Load()
+	a := writeCSV(t, dir, "a.csv", iris[:100])
+	b := writeCSV(t, dir, "b.csv", iris[100:])
+	loaded, err := LoadMany(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, iris) {
+		t.Fatalf("got %d records, expected the %d iris records in order", len(loaded), len(iris))
+	}
+	narrow := writeCSV(t, dir, "narrow.csv", []Fisher{{Measures: []float64{1, 2}, Label: "a"}})
+	if _, err := LoadMany(a, narrow); err == nil || !strings.Contains(err.Error(), "narrow.csv: record 0 has 2 measures, expected 4") {
+		t.Fatalf("got error %v, expected a width mismatch", err)
+	}
+	if _, err := LoadMany(a, filepath.Join(dir, "missing.csv")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got error %v, expected %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestLoadSparse(t *testing.T) {
+	iris, err := LoadSparse(strings.NewReader("a 1:1.5 3:2\n# comment\n\nb 2:-1\nc\n"), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		label    string
+		measures []float64
+	}{
+		{"a", []float64{1.5, 0, 2}},
+		{"b", []float64{0, -1, 0}},
+		{"c", []float64{0, 0, 0}},
+	}
+	if len(iris) != len(want) {
+		t.Fatalf("got %d records, expected %d", len(iris), len(want))
+	}
+	for i, record := range want {
+		if iris[i].Label != record.label || iris[i].Index != i {
+			t.Fatalf("record %d is %q index %d, expected %q index %d", i, iris[i].Label, iris[i].Index, record.label, i)
+		}
+		for j, value := range record.measures {
+			if iris[i].Measures[j] != value {
+				t.Fatalf("record %d measures %v, expected %v", i, iris[i].Measures, record.measures)
+			}
+		}
+	}
+	for _, input := range []string{"a 4:1", "a 0:1", "a 1", "a x:1", "a 1:x"} {
+		if _, err := LoadSparse(strings.NewReader(input), 3); err == nil {
+			t.Fatalf("expected an error for %q", input)
+		}
+	}
+	for _, dim := range []int{0, -1} {
+		if _, err := LoadSparse(strings.NewReader("a 1:1"), dim); err == nil {
+			t.Fatalf("expected an error for dimension %d", dim)
+		}
+	}
+}
+
+func TestRandomN(t *testing.T) {
+	iris := RandomN(1, 10000, Distribution{Kind: Normal, Mean: 5, StdDev: 2})
+	if len(iris) != 10000 {
+		t.Fatalf("got %d records, expected 10000", len(iris))
+	}
+	for c := range iris[0].Measures {
+		mean := 0.0
+		for _, value := range iris {
+			mean += value.Measures[c]
+		}
+		mean /= float64(len(iris))
+		// the standard error of the mean is 2/√10000 = .02
+		if math.Abs(mean-5) > .1 {
+			t.Fatalf("column %d has mean %v, expected 5", c, mean)
+		}
+	}
+	if iris := RandomN(1, -1, Distribution{}); len(iris) != 0 {
+		t.Fatalf("got %d records for a negative n, expected none", len(iris))
+	}
+}
+
+func TestRandomWeighted(t *testing.T) {
+	weights := map[string]float64{"a": 1, "b": 3, "c": 0}
+	iris := RandomWeighted(1, 20000, weights)
+	counts := LabelCounts(iris)
+	if counts["c"] != 0 {
+		t.Fatalf("zero weight label drawn %d times", counts["c"])
+	}
+	for label, want := range map[string]float64{"a": .25, "b": .75} {
+		if proportion := float64(counts[label]) / float64(len(iris)); math.Abs(proportion-want) > .01 {
+			t.Fatalf("label %s has proportion %v, expected %v", label, proportion, want)
+		}
+	}
+	if iris := RandomWeighted(1, -1, weights); len(iris) != 0 {
+		t.Fatalf("got %d records for a negative n, expected none", len(iris))
+	}
+}
+
+func TestLoadDataset(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		n     int
+		count int
+		fails bool
+	}{
+		{"iris", 0, 150, false},
+		{"random", 20, 20, false},
+		{"random", 0, 0, true},
+		{"wine", 0, 0, true},
+		{"unknown", 0, 0, true},
+	} {
+		iris, err := LoadDataset(test.name, test.n)
+		if (err != nil) != test.fails {
+			t.Fatalf("%s %d: got error %v, expected failure %v", test.name, test.n, err, test.fails)
+		}
+		if len(iris) != test.count {
+			t.Fatalf("%s %d: got %d records, expected %d", test.name, test.n, len(iris), test.count)
+		}
+	}
+	random, err := LoadDataset("random", 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := RandomN(0, 20, Distribution{Kind: Uniform}); !reflect.DeepEqual(random, want) {
+		t.Fatal("the random data set is not RandomN seeded 0")
+	}
+}
+
+func TestInjectAnomaly(t *testing.T) {
+	iris := Load()
+	injected := InjectAnomaly(iris, 2, 1)
+	if len(injected) != len(iris)+1 || len(iris) != 150 {
+		t.Fatalf("got %d records, expected %d", len(injected), len(iris)+1)
+	}
+	anomaly := injected[len(iris)]
+	if anomaly.Label != "anomaly" || anomaly.Index != len(iris) {
+		t.Fatalf("got label %q index %d, expected anomaly index %d", anomaly.Label, anomaly.Index, len(iris))
+	}
+	// each measure is beyond the column maximum by between scale and twice scale times the column range
+	for c, measure := range anomaly.Measures {
+		column := make([]float64, len(iris))
+		for i, value := range iris {
+			column[i] = value.Measures[c]
+		}
+		spread := floats.Max(column) - floats.Min(column)
+		if measure < floats.Max(column)+2*spread || measure > floats.Max(column)+4*spread {
+			t.Fatalf("measure %d is %v, expected it in [%v, %v]", c, measure, floats.Max(column)+2*spread, floats.Max(column)+4*spread)
+		}
+	}
+	if !reflect.DeepEqual(injected[:len(iris)], iris) {
+		t.Fatal("the original records changed")
+	}
+	if injected := InjectAnomaly(nil, 2, 1); len(injected) != 0 {
+		t.Fatalf("got %d records for no records, expected none", len(injected))
+	}
+}
+
+func TestMatMul(t *testing.T) {
+	iris := Load()
+	want, err := ProcessSimilarity(iris, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	cfg.MatMul = GonumMatMul
+	got, err := ProcessSimilarity(iris, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("GonumMatMul similarity %v, expected %v", got, want)
+	}
+	calls := 0
+	cfg.MatMul = func(dst, a, b *mat.Dense) {
+		calls++
+		dst.Mul(a, b)
+	}
+	got, err = ProcessSimilarity(iris, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("custom MatMul called %d times, expected 2", calls)
+	}
+	if diff := got - want; diff > 1e-12 || diff < -1e-12 {
+		t.Fatalf("custom MatMul similarity %v, expected %v", got, want)
+	}
+}
+
+const (
+	// processAllocs is the allocation budget of ProcessSimilarity on 50 records,
+	// most of the allocations are made by the eigenvalue decomposition
+	processAllocs = 110
+	// batchAllocs is the allocation budget per data set of ProcessBatch on 50 records,
+	// which reuses a workspace between the data sets
+	batchAllocs = 100
+)
+
+func TestProcessBatch(t *testing.T) {
+	datasets := [][]Fisher{Load(), Random(1), Load()[:30], Random(2)[:75], Random(3)}
+	cfg := DefaultConfig()
+	cfg.Workers = 2
+	similarities, err := ProcessBatch(datasets, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(similarities) != len(datasets) {
+		t.Fatalf("got %d similarities, expected %d", len(similarities), len(datasets))
+	}
+	for i, iris := range datasets {
+		want, err := ProcessSimilarity(iris, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if similarities[i] != want {
+			t.Fatalf("data set %d similarity %v, expected %v", i, similarities[i], want)
+		}
+	}
+}
+
+func TestProcessSimilarityAllocs(t *testing.T) {
+	iris := Random(1)[:50]
+	cfg := DefaultConfig()
+	allocs := testing.AllocsPerRun(20, func() {
+		if _, err := ProcessSimilarity(iris, cfg); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs > processAllocs {
+		t.Fatalf("ProcessSimilarity made %v allocations, budget %d", allocs, processAllocs)
+	}
+}
+
+func TestProcessBatchAllocs(t *testing.T) {
+	iris := Random(1)[:50]
+	cfg := DefaultConfig()
+	cfg.Workers = 1
+	datasets := make([][]Fisher, 16)
+	for i := range datasets {
+		datasets[i] = iris
+	}
+	allocs := testing.AllocsPerRun(20, func() {
+		if _, err := ProcessBatch(datasets, cfg); err != nil {
+			t.Fatal(err)
+		}
+	}) / float64(len(datasets))
+	if allocs > batchAllocs {
+		t.Fatalf("ProcessBatch made %v allocations per data set, budget %d", allocs, batchAllocs)
+	}
+}
+
+// BenchmarkEigenvectors decomposes the full adjacency matrix of 1000 records
+func BenchmarkEigenvectors(b *testing.B) {
+	iris := RandomN(1, 1000, Distribution{})
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := Eigenvectors(iris); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkEigenvectorColumns computes only the dominant eigenvector of the adjacency matrix of 1000 records
+func BenchmarkEigenvectorColumns(b *testing.B) {
+	iris := RandomN(1, 1000, Distribution{})
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := EigenvectorColumns(iris, 1); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestRandomBaseline(t *testing.T) {
+	cfg := DefaultConfig()
+	seeds := []int64{1, 2, 3}
+	similarities := make([]float64, 0, len(seeds))
+	for _, seed := range seeds {
+		similarity, err := ProcessSimilarity(Random(seed), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		similarities = append(similarities, similarity)
+	}
+	mean, std, err := RandomBaseline(seeds, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedMean, expectedStd := stat.MeanStdDev(similarities, nil)
+	if math.Abs(mean-expectedMean) > 1e-12 || math.Abs(std-expectedStd) > 1e-12 {
+		t.Fatalf("got %v ± %v, expected %v ± %v", mean, std, expectedMean, expectedStd)
+	}
+	mean, std, err = RandomBaseline(seeds[:1], cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mean != similarities[0] || std != 0 {
+		t.Fatalf("got %v ± %v for one seed, expected %v ± 0", mean, std, similarities[0])
+	}
+	if _, _, err := RandomBaseline(nil, cfg); err == nil {
+		t.Fatal("expected an error without seeds")
+	}
+}
+
+func TestMinibatches(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.BatchSize = 100
+	similarities, err := ProcessMinibatches(RandomN(1, 1050, Distribution{}), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(similarities) != 11 {
+		t.Fatalf("got %d similarities, expected one per batch 11", len(similarities))
+	}
+	iris := Load()
+	cfg.BatchSize = 149
+	similarities, err = ProcessMinibatches(iris, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(similarities) != 1 {
+		t.Fatalf("got %d similarities, expected the single record remainder to join the batch", len(similarities))
+	}
+	cfg.BatchSize = 100
+	similarity, err := ProcessSimilarity(iris, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	similarities, err = ProcessMinibatches(iris, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (100*similarities[0] + 50*similarities[1]) / 150; math.Abs(similarity-want) > 1e-12 {
+		t.Fatalf("similarity %v, expected the weighted mean %v", similarity, want)
+	}
+}
+
+func TestProcessFull(t *testing.T) {
+	iris := Load()
+	cfg := DefaultConfig()
+	result, err := ProcessFull(iris, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, c := result.Adjacency.Dims(); r != 150 || c != 150 {
+		t.Fatalf("adjacency is %d×%d, expected 150×150", r, c)
+	}
+	if r, c := result.SelfAttention.Dims(); r != 150 || c != 4 {
+		t.Fatalf("self attention is %d×%d, expected 150×4", r, c)
+	}
+	if len(result.Eigenvalues) != 150 {
+		t.Fatalf("got %d eigenvalues, expected 150", len(result.Eigenvalues))
+	}
+	if result.Duration <= 0 {
+		t.Fatalf("duration %v, expected a positive duration", result.Duration)
+	}
+	if result.EigenValue != cmplx.Abs(result.Eigenvalues[0]) {
+		t.Fatalf("eigenvalue %v, expected the magnitude of the first eigenvalue %v", result.EigenValue, cmplx.Abs(result.Eigenvalues[0]))
+	}
+	similarity, err := ProcessSimilarity(iris, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.CosineSimilarity != similarity {
+		t.Fatalf("similarity %v, expected %v", result.CosineSimilarity, similarity)
+	}
+	// the adjacency matrix is a·aᵀ and the self attention output the softmax of it times a
+	a := Matrix(iris)
+	if want := dot(a.RawRowView(3), a.RawRowView(7)); math.Abs(result.Adjacency.At(3, 7)-want) > 1e-12*want {
+		t.Fatalf("adjacency (3, 7) is %v, expected %v", result.Adjacency.At(3, 7), want)
+	}
+	row := mat.Row(nil, 3, result.Adjacency)
+	softmax(row)
+	if want := dot(row, mat.Col(nil, 0, a)); math.Abs(result.SelfAttention.At(3, 0)-want) > 1e-12*want {
+		t.Fatalf("self attention (3, 0) is %v, expected %v", result.SelfAttention.At(3, 0), want)
+	}
+}
+
+func TestColumns(t *testing.T) {
+	iris := Load()
+	a := MatrixColumns(iris, []int{2, 3})
+	if r, c := a.Dims(); r != 150 || c != 2 {
+		t.Fatalf("feature matrix is %d×%d, expected 150×2", r, c)
+	}
+	if a.At(7, 0) != iris[7].Measures[2] || a.At(7, 1) != iris[7].Measures[3] {
+		t.Fatalf("row 7 is %v, expected the petal measures of %v", a.RawRowView(7), iris[7].Measures)
+	}
+	cfg := DefaultConfig()
+	cfg.Columns = []int{2, 3}
+	result, err := ProcessFull(iris, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, c := result.SelfAttention.Dims(); r != 150 || c != 2 {
+		t.Fatalf("self attention is %d×%d, expected 150×2", r, c)
+	}
+	cfg.Columns = []int{4}
+	if _, err := ProcessSimilarity(iris, cfg); err == nil {
+		t.Fatal("expected an error for column 4 of 4 measures")
+	}
+}
+
+func TestWeights(t *testing.T) {
+	iris := Load()
+	adj := Adjacency(iris)
+	cfg := DefaultConfig()
+	cfg.Weights = make([]float64, len(iris))
+	for i := range cfg.Weights {
+		cfg.Weights[i] = 1
+	}
+	cfg.Weights[0] = 2
+	result, err := ProcessFull(iris, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// doubling the weight of record 0 doubles its diagonal entry and scales its other entries by √2
+	for j := range iris {
+		want := math.Sqrt2 * adj.At(0, j)
+		if j == 0 {
+			want = 2 * adj.At(0, j)
+		}
+		if got := result.Adjacency.At(0, j); math.Abs(got-want) > 1e-12*want {
+			t.Fatalf("entry (0, %d) is %v, expected %v", j, got, want)
+		}
+		if j > 0 && math.Abs(result.Adjacency.At(1, j)-adj.At(1, j)) > 1e-12*adj.At(1, j) {
+			t.Fatalf("entry (1, %d) is %v, expected the unweighted %v", j, result.Adjacency.At(1, j), adj.At(1, j))
+		}
+	}
+	cfg.Weights = cfg.Weights[1:]
+	if _, err := ProcessSimilarity(iris, cfg); err == nil {
+		t.Fatal("expected an error for 149 weights")
+	}
+}
+
+func TestFeatureSpace(t *testing.T) {
+	iris := Load()
+	cfg := DefaultConfig()
+	cfg.FeatureSpace = true
+	result, err := ProcessFull(iris, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, c := result.Adjacency.Dims(); r != 4 || c != 4 {
+		t.Fatalf("adjacency is %d×%d, expected 4×4", r, c)
+	}
+	if r, c := result.SelfAttention.Dims(); r != 4 || c != 150 {
+		t.Fatalf("self attention is %d×%d, expected 4×150", r, c)
+	}
+	if len(result.Eigenvalues) != 4 {
+		t.Fatalf("got %d eigenvalues, expected 4", len(result.Eigenvalues))
+	}
+	// the adjacency matrix is the gram matrix aᵀ·a of the measures
+	var want mat.Dense
+	a := Matrix(iris)
+	want.Mul(a.T(), a)
+	if !mat.EqualApprox(result.Adjacency, &want, 1e-9) {
+		t.Fatal("the adjacency matrix is not aᵀ·a")
+	}
+	cfg.Eigen = 4
+	if _, err := ProcessSimilarity(iris, cfg); err == nil {
+		t.Fatal("expected an error for eigenvector 4 of 4 measures")
+	}
+}
+
+func TestProcessFullSimilarities(t *testing.T) {
+	for _, iris := range [][]Fisher{Load(), Load()[:3], Random(1)} {
+		result, err := ProcessFull(iris, DefaultConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := min(len(iris), len(iris[0].Measures)); len(result.Similarities) != want {
+			t.Fatalf("got %d similarities, expected %d", len(result.Similarities), want)
+		}
+	}
+	// the per column similarities agree with the aggregate over the same components
+	iris := Random(1)
+	result, err := ProcessFull(iris, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	cfg.Components = 2
+	similarity, err := ProcessSimilarity(iris, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (result.Similarities[0] + result.Similarities[1]) / 2; math.Abs(similarity-want) > 1e-12 {
+		t.Fatalf("components similarity %v, expected the mean of the first two columns %v", similarity, want)
+	}
+}
+
+func TestReference(t *testing.T) {
+	iris := Load()
+	similarities := make(map[Reference]float64)
+	for _, reference := range []Reference{ReferenceEigenvector, ReferencePCA} {
+		cfg := DefaultConfig()
+		cfg.Reference = reference
+		similarity, err := ProcessSimilarity(iris, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.IsNaN(similarity) || math.Abs(similarity) > 1 {
+			t.Fatalf("reference %d similarity %v, expected a cosine similarity", reference, similarity)
+		}
+		similarities[reference] = similarity
+	}
+	if similarities[ReferenceEigenvector] == similarities[ReferencePCA] {
+		t.Fatalf("both references give similarity %v, expected distinct values", similarities[ReferencePCA])
+	}
+	scores, err := principal(Matrix(iris))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scores) != len(iris) || floats.Sum(scores) < 0 {
+		t.Fatalf("got %d scores summing to %v, expected %d summing to a nonnegative value", len(scores), floats.Sum(scores), len(iris))
+	}
+}
+
+func TestWeightByEigenvalue(t *testing.T) {
+	iris := Load()
+	cfg := DefaultConfig()
+	cfg.Components = 4
+	result, err := ProcessFull(iris, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weights := make([]float64, 4)
+	for c, index := range byMagnitude(result.Eigenvalues)[:4] {
+		weights[c] = cmplx.Abs(result.Eigenvalues[index])
+	}
+	mean := stat.Mean(result.Similarities[:4], nil)
+	weighted := stat.Mean(result.Similarities[:4], weights)
+	if math.Abs(result.CosineSimilarity-mean) > 1e-12 {
+		t.Fatalf("similarity %v, expected the mean %v", result.CosineSimilarity, mean)
+	}
+	cfg.WeightByEigenvalue = true
+	similarity, err := ProcessSimilarity(iris, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(similarity-weighted) > 1e-12 {
+		t.Fatalf("weighted similarity %v, expected %v", similarity, weighted)
+	}
+	// the principal component dominates the weights and has the highest similarity
+	if similarity-mean < .1 {
+		t.Fatalf("weighted similarity %v, expected it well above the unweighted %v", similarity, mean)
+	}
+}
+
+func TestEigenvalueThreshold(t *testing.T) {
+	iris := Load()
+	// the iris eigenvalue magnitudes relative to the largest are 1, .034, .0013, and .00038
+	for _, test := range []struct {
+		threshold  float64
+		components int
+	}{
+		{1e-4, 4},
+		{1e-3, 3},
+		{1e-2, 2},
+		{1e-1, 1},
+	} {
+		cfg := DefaultConfig()
+		cfg.EigenvalueThreshold = test.threshold
+		result, err := ProcessFull(iris, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Components != test.components {
+			t.Fatalf("threshold %v selects %d components, expected %d", test.threshold, result.Components, test.components)
+		}
+	}
+	cfg := DefaultConfig()
+	cfg.EigenvalueThreshold = 1.5
+	if _, err := ProcessSimilarity(iris, cfg); err == nil {
+		t.Fatal("expected an error for a threshold above 1")
+	}
+}
+
+func TestPhaseAlign(t *testing.T) {
+	adj := Adjacency(Load()[:10])
+	var eig mat.EigenSym
+	if !eig.Factorize(Symmetrize(adj), true) {
+		t.Fatal(ErrEigenFailed)
+	}
+	var vectors mat.Dense
+	eig.VectorsTo(&vectors)
+	// the dominant eigenvector rotated by an arbitrary global phase
+	n, _ := vectors.Dims()
+	want := mat.Col(nil, n-1, &vectors)
+	rotated := make([]complex128, n)
+	for i, value := range want {
+		rotated[i] = complex(value, 0) * cmplx.Rect(1, 2.1)
+	}
+	aligned := PhaseAlign(rotated)
+	sign := 1.0
+	if aligned[0]*want[0] < 0 {
+		sign = -1
+	}
+	for i, value := range want {
+		if math.Abs(aligned[i]-sign*value) > 1e-12 {
+			t.Fatalf("aligned %v, expected ±%v", aligned, want)
+		}
+	}
+}
+
+func TestFixSigns(t *testing.T) {
+	m := mat.NewCDense(3, 2, []complex128{
+		1, 0,
+		-3, 2i,
+		2, 0,
+	})
+	fixSigns(m)
+	if got := m.RawCMatrix().Data; !reflect.DeepEqual(got, []complex128{-1, 0, 3, 2, -2, 0}) {
+		t.Fatalf("got %v, expected the columns rotated to a positive largest component", got)
+	}
+	iris := Load()
+	var first *mat.CDense
+	for run := range 3 {
+		eigenvectors, err := Eigenvectors(iris)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for c := range 4 {
+			index, max := 0, 0.0
+			for r := range len(iris) {
+				if magnitude := cmplx.Abs(eigenvectors.At(r, c)); magnitude > max {
+					index, max = r, magnitude
+				}
+			}
+			if value := eigenvectors.At(index, c); real(value) <= 0 || imag(value) != 0 {
+				t.Fatalf("run %d column %d largest component is %v, expected positive", run, c, value)
+			}
+		}
+		if first == nil {
+			first = eigenvectors
+		} else if !mat.CEqual(first, eigenvectors) {
+			t.Fatalf("run %d eigenvectors differ from the first run", run)
+		}
+	}
+}
+
+func TestSymmetrize(t *testing.T) {
+	iris := Load()
+	want, err := ProcessFull(iris, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	cfg.Symmetrize = true
+	result, err := ProcessFull(iris, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a·aᵀ is already symmetric, so EigenSym finds the same dominant eigenvalue
+	if math.Abs(result.EigenValue-want.EigenValue) > 1e-9*want.EigenValue {
+		t.Fatalf("dominant eigenvalue %v, expected %v", result.EigenValue, want.EigenValue)
+	}
+	if math.Abs(result.CosineSimilarity-want.CosineSimilarity) > 1e-9 {
+		t.Fatalf("similarity %v, expected %v", result.CosineSimilarity, want.CosineSimilarity)
+	}
+	for c, value := range result.Eigenvalues {
+		if imag(value) != 0 {
+			t.Fatalf("eigenvalue %d is complex %v", c, value)
+		}
+		if c > 0 && cmplx.Abs(value) > cmplx.Abs(result.Eigenvalues[c-1]) {
+			t.Fatalf("eigenvalue %d %v is larger than the previous %v", c, value, result.Eigenvalues[c-1])
+		}
+	}
+	// a deliberately asymmetric matrix becomes (m + mᵀ)/2 and decomposes with EigenSym
+	m := mat.NewDense(3, 3, []float64{
+		2, 1, 0,
+		3, 2, 1,
+		4, 0, 2,
+	})
+	sym := Symmetrize(m)
+	for i := range 3 {
+		for j := range 3 {
+			if want := (m.At(i, j) + m.At(j, i)) / 2; sym.At(i, j) != want {
+				t.Fatalf("symmetrized (%d, %d) is %v, expected %v", i, j, sym.At(i, j), want)
+			}
+		}
+	}
+	var eigenvectors mat.CDense
+	values, err := eigenSym(&eigenvectors, m, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for c, value := range values {
+		vector := make([]float64, 3)
+		for r := range vector {
+			vector[r] = real(eigenvectors.At(r, c))
+		}
+		var product mat.VecDense
+		product.MulVec(sym, mat.NewVecDense(3, vector))
+		for r := range vector {
+			if math.Abs(product.AtVec(r)-real(value)*vector[r]) > 1e-12 {
+				t.Fatalf("column %d is not an eigenvector of the symmetrized matrix with eigenvalue %v", c, value)
+			}
+		}
+	}
+}
+
+func TestSphere(t *testing.T) {
+	iris := Load()
+	cfg := DefaultConfig()
+	cfg.Sphere = true
+	unit, err := ProcessFull(iris, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Radius = 2
+	scaled, err := ProcessFull(iris, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the adjacency matrix of the projected records scales with the square of the radius
+	n, _ := unit.Adjacency.Dims()
+	for i := range n {
+		for j := range n {
+			if want := 4 * unit.Adjacency.At(i, j); math.Abs(scaled.Adjacency.At(i, j)-want) > 1e-12*want {
+				t.Fatalf("adjacency (%d, %d) is %v, expected %v", i, j, scaled.Adjacency.At(i, j), want)
+			}
+		}
+	}
+	for _, radius := range []float64{0, -1} {
+		cfg.Radius = radius
+		if _, err := ProcessSimilarity(iris, cfg); err == nil {
+			t.Fatalf("expected an error for radius %v", radius)
+		}
+	}
+}
+
+func TestCosine(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Cosine = true
+	for _, iris := range [][]Fisher{Load(), RandomN(1, 50, Distribution{Kind: Normal, StdDev: 1})} {
+		result, err := ProcessFull(iris, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range iris {
+			if math.Abs(result.Adjacency.At(i, i)-1) > 1e-12 {
+				t.Fatalf("diagonal %d is %v, expected 1", i, result.Adjacency.At(i, i))
+			}
+			for j := range iris {
+				if value := result.Adjacency.At(i, j); value < -1-1e-12 || value > 1+1e-12 {
+					t.Fatalf("adjacency (%d, %d) is %v, expected a value in [-1, 1]", i, j, value)
+				}
+			}
+		}
+	}
+}
+
+func TestAdjacencySlice(t *testing.T) {
+	iris := Load()
+	adj := Adjacency(iris)
+	rows := AdjacencySlice(iris)
+	if len(rows) != len(iris) {
+		t.Fatalf("got %d rows, expected %d", len(rows), len(iris))
+	}
+	for i, row := range rows {
+		if len(row) != len(iris) {
+			t.Fatalf("row %d has %d values, expected %d", i, len(row), len(iris))
+		}
+		for j, value := range row {
+			if value != adj.At(i, j) {
+				t.Fatalf("entry (%d, %d) is %v, expected %v", i, j, value, adj.At(i, j))
+			}
+		}
+	}
+	if rows := AdjacencySlice(nil); len(rows) != 0 {
+		t.Fatalf("got %d rows for no records, expected none", len(rows))
+	}
+}
+
+func TestCSEpsilon(t *testing.T) {
+	tiny, unit := []float64{1e-10, 0}, []float64{1, 0}
+	if similarity := csEpsilon(tiny, unit, 0); math.Abs(similarity-1) > 1e-12 {
+		t.Fatalf("similarity %v without epsilon, expected 1", similarity)
+	}
+	// a vector with a norm at or below epsilon is treated as zero in either position
+	for _, test := range [][2][]float64{{tiny, unit}, {unit, tiny}, {{0, 0}, unit}} {
+		if similarity := csEpsilon(test[0], test[1], 1e-9); similarity != 0 {
+			t.Fatalf("similarity of %v and %v is %v, expected 0", test[0], test[1], similarity)
+		}
+	}
+	if distance := MetricEuclidean.CompareEpsilon(tiny, unit, 1e-9); distance != math.Sqrt2 {
+		t.Fatalf("euclidean distance %v, expected √2 for a zero vector", distance)
+	}
+}
+
+func TestCosineMatrix(t *testing.T) {
+	iris := Load()
+	m := CosineMatrix(iris)
+	if r, c := m.Dims(); r != 150 || c != 150 {
+		t.Fatalf("cosine matrix is %d×%d, expected 150×150", r, c)
+	}
+	for i := range iris {
+		if math.Abs(m.At(i, i)-1) > 1e-12 {
+			t.Fatalf("diagonal %d is %v, expected 1", i, m.At(i, i))
+		}
+		for j := range iris {
+			if m.At(i, j) != m.At(j, i) {
+				t.Fatalf("entry (%d, %d) is %v and (%d, %d) is %v, expected a symmetric matrix", i, j, m.At(i, j), j, i, m.At(j, i))
+			}
+		}
+	}
+	if want := cs(iris[3].Measures, iris[90].Measures); m.At(3, 90) != want {
+		t.Fatalf("entry (3, 90) is %v, expected %v", m.At(3, 90), want)
+	}
+	if r, c := CosineMatrix(nil).Dims(); r != 0 || c != 0 {
+		t.Fatalf("got a %d×%d matrix for no records, expected an empty matrix", r, c)
+	}
+}
+
+func TestDegreeNormalize(t *testing.T) {
+	// spread is the ratio of the largest to the smallest row magnitude of the self attention output
+	spread := func(normalize bool) float64 {
+		cfg := DefaultConfig()
+		cfg.Softmax = false
+		cfg.DegreeNormalize = normalize
+		result, err := ProcessFull(Load(), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, _ := result.SelfAttention.Dims()
+		norms := make([]float64, n)
+		for r := range norms {
+			norms[r] = abs(result.SelfAttention.RawRowView(r))
+		}
+		return floats.Max(norms) / floats.Min(norms)
+	}
+	// the raw rows grow with the degree of the record, the normalized rows are weighted means of the records
+	raw, normalized := spread(false), spread(true)
+	if normalized > 1.1 || normalized >= raw {
+		t.Fatalf("row magnitude spread %v normalized and %v raw, expected comparable normalized rows", normalized, raw)
+	}
+}
+
+func TestNeighbors(t *testing.T) {
+	iris := Load()
+	adj := Adjacency(iris)
+	neighbors(adj, 5)
+	most := 0
+	for i := range iris {
+		count := 0
+		for j, value := range adj.RawRowView(i) {
+			if value != 0 {
+				count++
+			}
+			if (value == 0) != (adj.At(j, i) == 0) {
+				t.Fatalf("entry (%d, %d) is kept in only one direction", i, j)
+			}
+		}
+		if adj.At(i, i) != 0 {
+			t.Fatalf("row %d keeps its diagonal", i)
+		}
+		if count < 5 {
+			t.Fatalf("row %d keeps %d entries, expected at least 5", i, count)
+		}
+		most = max(most, count)
+	}
+	// with the dot product a hub record is among the 5 nearest of every other record
+	if most != len(iris)-1 {
+		t.Fatalf("the hub row keeps %d entries, expected %d", most, len(iris)-1)
+	}
+	cfg := DefaultConfig()
+	cfg.KNN = 5
+	if _, err := ProcessSimilarity(iris, cfg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResidual(t *testing.T) {
+	iris := Load()
+	base, err := ProcessFull(iris, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	cfg.Residual = false
+	disabled, err := ProcessSimilarity(iris, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if disabled != base.CosineSimilarity {
+		t.Fatalf("disabled residual similarity %v, expected the default %v", disabled, base.CosineSimilarity)
+	}
+	cfg.Residual = true
+	residual, err := ProcessFull(iris, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want mat.Dense
+	want.Add(base.SelfAttention, Matrix(iris))
+	if !mat.EqualApprox(residual.SelfAttention, &want, 1e-12) {
+		t.Fatal("the residual output is not the self attention output plus the features")
+	}
+	if residual.CosineSimilarity == base.CosineSimilarity {
+		t.Fatalf("residual similarity %v, expected it to differ from the default", residual.CosineSimilarity)
+	}
+}
+
+func TestLayerNorm(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.LayerNorm = true
+	result, err := ProcessFull(Load(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _ := result.SelfAttention.Dims()
+	for r := range n {
+		// the epsilon of the variance shrinks the standard deviation slightly below one
+		mean, variance := stat.PopMeanVariance(result.SelfAttention.RawRowView(r), nil)
+		if math.Abs(mean) > 1e-9 || math.Abs(math.Sqrt(variance)-1) > 1e-4 {
+			t.Fatalf("row %d has mean %v and standard deviation %v, expected 0 and 1", r, mean, math.Sqrt(variance))
+		}
+	}
+}
+
+func TestDiagonalEpsilon(t *testing.T) {
+	// multiples of one vector have a rank one adjacency matrix
+	iris := make([]Fisher, 20)
+	for i := range iris {
+		scale := float64(i + 1)
+		iris[i].Measures = []float64{scale, 2 * scale, 3 * scale, 4 * scale}
+	}
+	cfg := DefaultConfig()
+	cfg.DiagonalEpsilon = 1e-3
+	result, err := ProcessFull(iris, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the epsilon shifts the zero eigenvalues of the rank deficient matrix to epsilon
+	order := byMagnitude(result.Eigenvalues)
+	for _, c := range order[1:] {
+		if math.Abs(cmplx.Abs(result.Eigenvalues[c])-cfg.DiagonalEpsilon) > 1e-6 {
+			t.Fatalf("eigenvalue %v, expected the shifted zero eigenvalue %v", result.Eigenvalues[c], cfg.DiagonalEpsilon)
+		}
+	}
+}
+
+func TestTrialsProgress(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Workers = 4
+	var done []int
+	results := Trials(Load()[:50], 8, cfg, func(d, total int) {
+		if total != 9 {
+			t.Errorf("total %d, expected 9", total)
+		}
+		done = append(done, d)
+	})
+	if len(results) != 9 {
+		t.Fatalf("got %d results, expected 9", len(results))
+	}
+	if len(done) != 9 {
+		t.Fatalf("progress called %d times, expected 9", len(done))
+	}
+	for i, d := range done {
+		if d != i+1 {
+			t.Fatalf("progress %d reported %d done, expected %d", i, d, i+1)
+		}
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	iris := Load()
+	serial, parallel := DefaultConfig(), DefaultConfig()
+	serial.Workers, parallel.Workers = 1, 4
+	want := Trials(iris, 8, serial, nil)
+	if got := Trials(iris, 8, parallel, nil); !reflect.DeepEqual(got, want) {
+		t.Fatal("the trials with 4 workers differ from the serial trials")
+	}
+	datasets := [][]Fisher{iris, Random(1), Random(2), Random(3)}
+	expected, err := ProcessBatch(datasets, serial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ProcessBatch(datasets, parallel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %v with 4 workers, expected the serial %v", got, expected)
+	}
+}
+
+func TestTrialsContinuePastFailure(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Eigen = 100
+	results := Trials(Load()[:20], 2, cfg, nil)
+	if len(results) != 3 {
+		t.Fatalf("got %d results, expected 3", len(results))
+	}
+	if results[0].Err == nil {
+		t.Fatal("expected the 20 record trial to fail validation")
+	}
+	for i, result := range results[1:] {
+		if result.Err != nil {
+			t.Fatalf("trial %d: %v", i+1, result.Err)
+		}
+	}
+
+	// a decomposition that fails on the 20 record data set fails only that trial in process
+	factorize := eigenFactorize
+	defer func() {
+		eigenFactorize = factorize
+	}()
+	eigenFactorize = func(eig *mat.Eigen, m *mat.Dense) bool {
+		if n, _ := m.Dims(); n == 20 {
+			return false
+		}
+		return factorize(eig, m)
+	}
+	cfg.Eigen = 0
+	results = Trials(Load()[:20], 2, cfg, nil)
+	if !errors.Is(results[0].Err, ErrEigenFailed) {
+		t.Fatalf("got error %v, expected %v", results[0].Err, ErrEigenFailed)
+	}
+	for i, result := range results[1:] {
+		if result.Err != nil {
+			t.Fatalf("trial %d: %v", i+1, result.Err)
+		}
+	}
+}
+
+func TestSpectralDistance(t *testing.T) {
+	iris, random := Load(), Random(1)
+	same, err := SpectralDistance(iris, iris)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same != 0 {
+		t.Fatalf("distance of a data set to itself is %v, expected 0", same)
+	}
+	d, err := SpectralDistance(iris, random)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, _ := Eigenvalues(iris)
+	y, _ := Eigenvalues(random)
+	// the distance is dominated by the difference of the principal eigenvalues
+	if d < x[0]-y[0] {
+		t.Fatalf("distance %v, expected at least the principal eigenvalue difference %v", d, x[0]-y[0])
+	}
+	if reverse, _ := SpectralDistance(random, iris); reverse != d {
+		t.Fatalf("reverse distance %v, expected %v", reverse, d)
+	}
+	if _, err := SpectralDistance(iris, random[:10]); err == nil {
+		t.Fatal("expected an error for data sets of different sizes")
+	}
+}
+
+func TestSpectralGap(t *testing.T) {
+	values, err := Eigenvalues(Load())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gap, err := SpectralGap(Load())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gap != values[0]-values[1] {
+		t.Fatalf("gap %v, expected %v", gap, values[0]-values[1])
+	}
+	random, err := SpectralGap(Random(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the structured iris data set is dominated by its principal direction far more than uniform noise
+	if gap < 10*random {
+		t.Fatalf("iris gap %v, expected at least ten times the random gap %v", gap, random)
+	}
+}
+
+func TestEmptySpectrum(t *testing.T) {
+	if _, err := SpectralGap(nil); err == nil {
+		t.Fatal("expected an error for the spectral gap of an empty data set")
+	}
+	if _, err := SpectralDistance(nil, nil); err == nil {
+		t.Fatal("expected an error for the spectral distance of empty data sets")
+	}
+	if _, err := EffectiveRank(nil); err == nil {
+		t.Fatal("expected an error for the effective rank of an empty data set")
+	}
+	if _, err := ConditionNumber(nil); err == nil {
+		t.Fatal("expected an error for the condition number of an empty data set")
+	}
+	if rows := AdjacencySlice(nil); len(rows) != 0 {
+		t.Fatalf("got %d adjacency rows, expected none", len(rows))
+	}
+	if n, _ := CosineMatrix(nil).Dims(); n != 0 {
+		t.Fatalf("got a %d row cosine matrix, expected an empty one", n)
+	}
+}
+
+func TestConditionNumber(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		iris   []Fisher
+		lo, hi float64
+	}{
+		// the adjacency eigenvalues are about 2 and 5e-9
+		{"near singular", []Fisher{{Measures: []float64{1, 0}}, {Measures: []float64{1, 1e-4}}}, 1e8, 1e9},
+		{"orthonormal", []Fisher{{Measures: []float64{1, 0}}, {Measures: []float64{0, 1}}}, 1, 1 + 1e-12},
+		// the zero eigenvalue of a singular adjacency matrix is ignored
+		{"singular", []Fisher{{Measures: []float64{1, 0}}, {Measures: []float64{2, 0}}}, 1, 1 + 1e-12},
+	} {
+		condition, err := ConditionNumber(test.iris)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if condition < test.lo || condition > test.hi {
+			t.Fatalf("%s condition number %v, expected it in [%v, %v]", test.name, condition, test.lo, test.hi)
+		}
+	}
+	if _, err := ConditionNumber([]Fisher{{Measures: []float64{0, 0}}}); err == nil {
+		t.Fatal("expected an error for a zero adjacency matrix")
+	}
+}
+
+func TestFactorize(t *testing.T) {
+	m := mat.NewDense(2, 2, []float64{1, 0, 0, 1})
+	calls := 0
+	fail := func(*mat.Dense) bool {
+		calls++
+		return false
+	}
+	if err := factorize(m, 2, 1e-9, fail); !errors.Is(err, ErrEigenFailed) {
+		t.Fatalf("got error %v, expected %v", err, ErrEigenFailed)
+	}
+	if calls != 3 {
+		t.Fatalf("decompose called %d times, expected 3", calls)
+	}
+
+	// a decomposition that fails once succeeds on the perturbed matrix
+	var perturbed *mat.Dense
+	calls = 0
+	once := func(m *mat.Dense) bool {
+		calls++
+		perturbed = mat.DenseCopyOf(m)
+		return calls > 1
+	}
+	if err := factorize(m, 2, 1e-9, once); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("decompose called %d times, expected 2", calls)
+	}
+	epsilon := perturbed.At(0, 0) - 1
+	if epsilon < 0 || epsilon >= 1e-9 || perturbed.At(1, 1) != 1+epsilon || perturbed.At(0, 1) != 0 || perturbed.At(1, 0) != 0 {
+		t.Fatalf("retried with %v, expected the identity plus a diagonal perturbation in [0, 1e-9)", mat.Formatted(perturbed))
+	}
+	if !mat.Equal(m, mat.NewDense(2, 2, []float64{1, 0, 0, 1})) {
+		t.Fatal("the matrix was modified")
+	}
+
+	// process recovers from a failed decomposition with a retry
+	factorize := eigenFactorize
+	defer func() {
+		eigenFactorize = factorize
+	}()
+	calls = 0
+	eigenFactorize = func(eig *mat.Eigen, m *mat.Dense) bool {
+		calls++
+		return calls > 1 && factorize(eig, m)
+	}
+	cfg := DefaultConfig()
+	cfg.Retries, cfg.Jitter = 1, 1e-9
+	if _, err := ProcessSimilarity(Load(), cfg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRound(t *testing.T) {
+	for _, test := range []struct {
+		value float64
+		want  float64
+	}{
+		{0.97654321, 0.977},
+		{0.1234, 0.123},
+		{-0.0005, -0.001},
+		{1, 1},
+	} {
+		if rounded := Round(test.value, 3); rounded != test.want {
+			t.Fatalf("Round(%v, 3) is %v, expected %v", test.value, rounded, test.want)
+		}
+	}
+	if rounded := Round(0.5, 400); rounded != 0.5 {
+		t.Fatalf("Round(0.5, 400) is %v, expected 0.5", rounded)
+	}
+	precision := *FlagPrecision
+	defer func() {
+		*FlagPrecision = precision
+	}()
+	*FlagPrecision = 3
+	if formatted := formatSimilarity(0.97654321); formatted != "0.977" {
+		t.Fatalf("formatted %q, expected 0.977", formatted)
+	}
+	*FlagPrecision = 400
+	if formatted := formatSimilarity(0.5); formatted != "0.50000000000000000" {
+		t.Fatalf("formatted %q, expected 17 decimal places", formatted)
+	}
+}
+
+func TestEMA(t *testing.T) {
+	ema := EMA{Alpha: .5}
+	// the first value initializes the average, each later value moves it halfway
+	for i, step := range []struct {
+		value, average float64
+	}{
+		{4, 4},
+		{8, 6},
+		{2, 4},
+		{6, 5},
+	} {
+		if average := ema.Update(step.value); average != step.average {
+			t.Fatalf("update %d average %v, expected %v", i, average, step.average)
+		}
+	}
+	if ema.Count != 4 || ema.Value != 5 {
+		t.Fatalf("got count %d value %v, expected count 4 value 5", ema.Count, ema.Value)
+	}
+}
+
+func TestCapSize(t *testing.T) {
+	iris := Load()
+	var warn strings.Builder
+	capped, err := capSize(iris, 40, true, &warn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(capped) != 40 {
+		t.Fatalf("got %d records, expected 40", len(capped))
+	}
+	if !reflect.DeepEqual(capped, Subsample(iris, 40, 1)) {
+		t.Fatal("the capped data set is not the seeded subsample")
+	}
+	if !strings.Contains(warn.String(), "subsampling 150 records to 40") {
+		t.Fatalf("got warning %q", warn.String())
+	}
+	warn.Reset()
+	if _, err := capSize(iris, 40, false, &warn); err == nil {
+		t.Fatal("expected an error over the cap without subsampling")
+	}
+	for _, maxn := range []int{0, 150, 200} {
+		if capped, err := capSize(iris, maxn, false, &warn); err != nil || len(capped) != 150 {
+			t.Fatalf("cap %d gave %d records, %v, expected the data set unchanged", maxn, len(capped), err)
+		}
+	}
+	if warn.Len() != 0 {
+		t.Fatalf("got warning %q, expected none", warn.String())
+	}
+}
+
+func TestOrderedLog(t *testing.T) {
+	var buffer strings.Builder
+	log := newOrderedLog(&buffer)
+	for _, step := range []struct {
+		trial   int
+		written string
+	}{
+		{2, ""},
+		{1, ""},
+		{0, "0\n1\n2\n"},
+		{4, "0\n1\n2\n"},
+		{3, "0\n1\n2\n3\n4\n"},
+	} {
+		log.Add(step.trial, fmt.Sprint(step.trial))
+		if buffer.String() != step.written {
+			t.Fatalf("after trial %d got %q, expected %q", step.trial, buffer.String(), step.written)
+		}
+	}
+}
+
+func TestReplayFailures(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Temperature = .1
+	iris := Load()
+	failures := run(io.Discard, iris, cfg, 0, nil, nil)
+	if len(failures) == 0 {
+		t.Fatal("expected trials below threshold at temperature .1")
+	}
+	failed := make(map[Failure]bool)
+	for _, failure := range failures {
+		failed[failure] = true
+		replayed, err := replay(io.Discard, iris, failure.Seed, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, r := range replayed {
+			found = found || r == failure
+		}
+		if !found {
+			t.Fatalf("replaying %v gave failures %v", failure, replayed)
+		}
+	}
+	// a seed that was not reported is not below threshold when replayed
+	for seed := int64(0); seed <= 128; seed++ {
+		if failed[Failure{Seed: seed, Softmax: true}] || failed[Failure{Seed: seed}] {
+			continue
+		}
+		replayed, err := replay(io.Discard, iris, seed, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(replayed) != 0 {
+			t.Fatalf("replaying seed %d gave failures %v", seed, replayed)
+		}
+		break
+	}
+}
+
+// TestHelperProcess runs main with the arguments following "--" when the test binary is run by lemma
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("LEMMA_HELPER_PROCESS") != "1" {
+		return
+	}
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	os.Args = append([]string{"lemma"}, args[1:]...)
+	main()
+	os.Exit(0)
+}
+
+// lemma runs main with the arguments in a subprocess and returns its stdout and exit code
+func lemma(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], append([]string{"-test.run=^TestHelperProcess$", "--"}, args...)...)
+	cmd.Env = append(os.Environ(), "LEMMA_HELPER_PROCESS=1")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		return stdout.String(), exit.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return stdout.String(), 0
+}
+
+func TestPrintBootstrap(t *testing.T) {
+	iris, cfg := Load(), DefaultConfig()
+	similarity, err := ProcessSimilarity(iris, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	widths := make([]float64, 0, 2)
+	for _, b := range []int{20, 100} {
+		_, lo, hi, err := BootstrapSimilarity(iris, b, 1, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if similarity < lo || similarity > hi {
+			t.Fatalf("%d samples give the interval [%v, %v], expected it to contain the estimate %v", b, lo, hi, similarity)
+		}
+		var buffer strings.Builder
+		if err := printBootstrap(&buffer, iris, cfg, b, false); err != nil {
+			t.Fatal(err)
+		}
+		want := fmt.Sprintf("\ncosine similarity %s [%s, %s] over %d bootstrap samples\n", formatSimilarity(similarity), formatSimilarity(lo), formatSimilarity(hi), b)
+		if buffer.String() != want {
+			t.Fatalf("got %q, expected %q", buffer.String(), want)
+		}
+		widths = append(widths, hi-lo)
+	}
+	// the extreme samples of the smaller bootstrap widen its interval
+	if !(widths[1] < widths[0]) {
+		t.Fatalf("interval widths %v, expected the 100 sample interval to be narrower", widths)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	version := Version()
+	if !strings.HasPrefix(version, "lemma ") || !strings.Contains(version, runtime.Version()) || !strings.Contains(version, " gonum ") {
+		t.Fatalf("got version %q, expected the module, go, and gonum versions", version)
+	}
+	stdout, code := lemma(t, "-version")
+	if stdout != version+"\n" || code != 0 {
+		t.Fatalf("got stdout %q and exit code %d, expected %q and 0", stdout, code, version)
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs the trials in a subprocess")
+	}
+	stdout, code := lemma(t, "-q")
+	if stdout != "" || code != 0 {
+		t.Fatalf("got stdout %q and exit code %d, expected no output and 0", stdout, code)
+	}
+	// the non principal eigenvector falls below threshold
+	stdout, code = lemma(t, "-q", "-eigen", "1", "-seed", "0")
+	if stdout != "" || code != 1 {
+		t.Fatalf("got stdout %q and exit code %d, expected no output and 1", stdout, code)
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	// the replayed trial falls below threshold with and without softmax
+	for _, test := range []struct {
+		allowed string
+		code    int
+	}{
+		{"0", 1},
+		{"1", 1},
+		{"2", 0},
+	} {
+		stdout, code := lemma(t, "-eigen", "1", "-seed", "0", "-allowed", test.allowed)
+		if code != test.code {
+			t.Fatalf("-allowed %s exited with %d, expected %d", test.allowed, code, test.code)
+		}
+		if !strings.Contains(stdout, "cosine similarity") {
+			t.Fatalf("-allowed %s did not print the results: %q", test.allowed, stdout)
+		}
+	}
+}
+
+func TestData(t *testing.T) {
+	iris := Load()
+	path := filepath.Join(t.TempDir(), "iris.csv")
+	var buffer bytes.Buffer
+	if err := WriteCSV(&buffer, iris); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buffer.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := ProcessFull(iris, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want strings.Builder
+	if err := printResult(&want, *result); err != nil {
+		t.Fatal(err)
+	}
+	stdout, code := lemma(t, "-data", path)
+	if stdout != want.String() || code != 0 {
+		t.Fatalf("got stdout %q and exit code %d, expected %q and 0", stdout, code, want.String())
+	}
+	if _, code := lemma(t, "-data", filepath.Join(t.TempDir(), "missing.csv")); code != 1 {
+		t.Fatalf("a missing file exited with %d, expected 1", code)
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	var buffer bytes.Buffer
+	writeMetrics(&buffer, []summary{
+		{softmax: true, trials: 129, below: 2, mean: .97},
+		{softmax: false, trials: 129, below: 0, mean: .999},
+	})
+	sample := regexp.MustCompile(`^lemma_[a-z_]+\{softmax="(true|false)"\} [0-9]+(\.[0-9]+)?$`)
+	comment := regexp.MustCompile(`^# (HELP lemma_[a-z_]+ .+|TYPE lemma_[a-z_]+ (counter|gauge))$`)
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+	if len(lines) != 12 {
+		t.Fatalf("got %d lines, expected 12", len(lines))
+	}
+	for _, line := range lines {
+		if !sample.MatchString(line) && !comment.MatchString(line) {
+			t.Fatalf("malformed metric line %q", line)
+		}
+	}
+	if !strings.Contains(buffer.String(), `lemma_below_threshold_total{softmax="true"} 2`) {
+		t.Fatalf("missing below threshold count in\n%s", buffer.String())
+	}
+}
+
+func TestSoftmax(t *testing.T) {
+	iris := Load()
+	cfg := DefaultConfig()
+	with, err := ProcessSimilarity(iris, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Softmax = false
+	without, err := ProcessSimilarity(iris, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// without softmax the attention is a power iteration step and is closer to the eigenvector
+	if !(with < without) || without < .9999 {
+		t.Fatalf("similarity %v with softmax and %v without, expected the raw adjacency to be closer to 1", with, without)
+	}
+}
+
+func TestSoftmaxRows(t *testing.T) {
+	adj := Adjacency(Load())
+	for _, temperature := range []float64{0, 1, .5, 10} {
+		m := mat.DenseCopyOf(adj)
+		softmaxRows(m, temperature)
+		rows, _ := m.Dims()
+		for r := range rows {
+			row := mat.Row(nil, r, adj)
+			if temperature != 0 {
+				floats.Scale(1/temperature, row)
+			}
+			softmax(row)
+			if !floats.Equal(m.RawRowView(r), row) {
+				t.Fatalf("temperature %v row %d differs from the row softmax", temperature, r)
+			}
+		}
+	}
+}
+
+func TestCheckRows(t *testing.T) {
+	m := Attention(Load())
+	if err := checkRows(m, 1e-9); err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []float64{.5, math.NaN()} {
+		corrupted := mat.DenseCopyOf(m)
+		corrupted.Set(7, 3, value)
+		err := checkRows(corrupted, 1e-9)
+		if err == nil || !strings.Contains(err.Error(), "row 7") {
+			t.Fatalf("got error %v for entry %v, expected row 7 to fail", err, value)
+		}
+	}
+	cfg := DefaultConfig()
+	cfg.Validate = true
+	if _, err := ProcessSimilarity(Load(), cfg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArgmax(t *testing.T) {
+	for _, test := range []struct {
+		values []float64
+		want   int
+	}{
+		{[]float64{1, 3, 3}, 1},
+		{[]float64{2, 2, 2}, 0},
+		{[]float64{-1, -3, 0}, 2},
+		{[]float64{5}, 0},
+	} {
+		if index := argmax(test.values); index != test.want {
+			t.Fatalf("argmax(%v) is %d, expected %d", test.values, index, test.want)
+		}
+	}
+}
+
+func TestTemperatureSchedule(t *testing.T) {
+	temperatures := TemperatureSchedule(4, 1, 5)
+	want := []float64{4, 1 + 3*(1+math.Sqrt2/2)/2, 2.5, 1 + 3*(1-math.Sqrt2/2)/2, 1}
+	if len(temperatures) != len(want) {
+		t.Fatalf("got %d temperatures, expected %d", len(temperatures), len(want))
+	}
+	for l, temperature := range temperatures {
+		if math.Abs(temperature-want[l]) > 1e-12 {
+			t.Fatalf("layer %d temperature %v, expected %v", l, temperature, want[l])
+		}
+	}
+	if temperatures := TemperatureSchedule(4, 1, 1); len(temperatures) != 1 || temperatures[0] != 4 {
+		t.Fatalf("single layer temperatures %v, expected [4]", temperatures)
+	}
+	if temperatures := TemperatureSchedule(4, 1, -1); len(temperatures) != 0 {
+		t.Fatalf("negative layer temperatures %v, expected none", temperatures)
+	}
+}
+
+func TestTemperature(t *testing.T) {
+	iris := Load()
+	want, err := ProcessSimilarity(iris, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	cfg.Temperature = 1
+	if similarity, err := ProcessSimilarity(iris, cfg); err != nil || similarity != want {
+		t.Fatalf("temperature 1 similarity %v %v, expected %v", similarity, err, want)
+	}
+	// a hot softmax averages broadly, the rows of the attention approach the uniform distribution
+	m := mat.NewDense(1, 3, []float64{1, 2, 3})
+	softmaxRows(m, 1e6)
+	for _, value := range m.RawRowView(0) {
+		if math.Abs(value-1.0/3) > 1e-6 {
+			t.Fatalf("hot softmax %v, expected uniform", m.RawRowView(0))
+		}
+	}
+	cfg.Temperature = -1
+	if _, err := ProcessSimilarity(iris, cfg); err == nil {
+		t.Fatal("expected a negative temperature to fail validation")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2025 The Lemma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+
+	"gonum.org/v1/gonum/stat"
+)
+
+// Metric is the comparison between the reference signal and the self attention output
+type Metric int
+
+const (
+	// MetricCosine is the cosine similarity
+	MetricCosine Metric = iota
+	// MetricEuclidean is the euclidean distance between the unit normalized vectors
+	MetricEuclidean
+	// MetricCorrelationDistance is one minus the pearson correlation
+	MetricCorrelationDistance
+)
+
+// Distance reports whether smaller values of the metric mean more alike
+func (m Metric) Distance() bool {
+	return m != MetricCosine
+}
+
+// Compare compares the two vectors with the metric
+func (m Metric) Compare(a, b []float64) float64 {
+	return m.CompareEpsilon(a, b, 0)
+}
+
+// CompareEpsilon compares the two vectors with the metric, a vector with a norm of at most
+// epsilon is treated as zero
+func (m Metric) CompareEpsilon(a, b []float64, epsilon float64) float64 {
+	switch m {
+	case MetricEuclidean:
+		aa, bb := abs(a), abs(b)
+		if aa <= epsilon || bb <= epsilon {
+			return math.Sqrt2
+		}
+		sum := 0.0
+		for i, value := range a {
+			diff := value/aa - b[i]/bb
+			sum += diff * diff
+		}
+		return math.Sqrt(sum)
+	case MetricCorrelationDistance:
+		correlation := stat.Correlation(a, b, nil)
+		if math.IsNaN(correlation) {
+			return 1
+		}
+		return 1 - correlation
+	}
+	return csEpsilon(a, b, epsilon)
+}
+
+// Fails reports whether the value is outside of the similarity threshold,
+// distances fail when they are greater than 1 - threshold
+func (m Metric) Fails(value, threshold float64) bool {
+	if m.Distance() {
+		return value > 1-threshold
+	}
+	return value < threshold
+}
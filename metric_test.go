@@ -0,0 +1,32 @@
+// Copyright 2025 The Lemma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMetricCorrelationDistance(t *testing.T) {
+	for _, test := range []struct {
+		a, b     []float64
+		distance float64
+	}{
+		{[]float64{1, 2, 3}, []float64{2, 4, 6}, 0},
+		{[]float64{1, 2, 3}, []float64{3, 2, 1}, 2},
+		{[]float64{1, 2, 3}, []float64{1, 0, 1}, 1},
+		// the pearson correlation is 4/5
+		{[]float64{1, 2, 3, 4}, []float64{1, 3, 2, 4}, .2},
+		// a constant vector has no correlation
+		{[]float64{1, 2, 3}, []float64{5, 5, 5}, 1},
+	} {
+		if distance := MetricCorrelationDistance.Compare(test.a, test.b); math.Abs(distance-test.distance) > 1e-12 {
+			t.Fatalf("distance between %v and %v is %v, expected %v", test.a, test.b, distance, test.distance)
+		}
+	}
+	if !MetricCorrelationDistance.Distance() || !MetricCorrelationDistance.Fails(.2, .95) || MetricCorrelationDistance.Fails(.01, .95) {
+		t.Fatal("expected the correlation distance to fail above 1 - threshold")
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2025 The Lemma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"gonum.org/v1/gonum/stat"
+)
+
+// Bootstrap returns a sample of the data set of the same size drawn with replacement,
+// the records keep their original Index
+func Bootstrap(iris []Fisher, seed int64) []Fisher {
+	rng := rand.New(rand.NewSource(seed))
+	sample := make([]Fisher, len(iris))
+	for i := range sample {
+		sample[i] = iris[rng.Intn(len(iris))]
+	}
+	return sample
+}
+
+// Subsample returns n records of the data set drawn without replacement in their original order,
+// the records keep their original Index. The data set is returned unchanged if it has at most n records.
+func Subsample(iris []Fisher, n int, seed int64) []Fisher {
+	if n >= len(iris) {
+		return iris
+	}
+	indexes := rand.New(rand.NewSource(seed)).Perm(len(iris))[:max(n, 0)]
+	sort.Ints(indexes)
+	sample := make([]Fisher, len(indexes))
+	for i, index := range indexes {
+		sample[i] = iris[index]
+	}
+	return sample
+}
+
+// BootstrapSimilarity computes the cosine similarity over b bootstrap samples of the data set seeded
+// seed through seed+b-1 and returns the mean and the 95% percentile interval
+func BootstrapSimilarity(iris []Fisher, b int, seed int64, cfg Config) (mean, lo, hi float64, err error) {
+	if b < 1 {
+		return 0, 0, 0, errors.New("bootstrap requires at least one sample")
+	}
+	if len(iris) == 0 {
+		return 0, 0, 0, errors.New("empty data set")
+	}
+	datasets := make([][]Fisher, b)
+	for i := range datasets {
+		datasets[i] = Bootstrap(iris, seed+int64(i))
+	}
+	similarities, err := ProcessBatch(datasets, cfg)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	sort.Float64s(similarities)
+	mean = stat.Mean(similarities, nil)
+	lo = stat.Quantile(.025, stat.Empirical, similarities, nil)
+	hi = stat.Quantile(.975, stat.Empirical, similarities, nil)
+	return mean, lo, hi, nil
+}
+
+// PerClassSimilarity computes for each label the cosine similarity of the records of that label
+// combined with a same size random sample of the other records
+func PerClassSimilarity(iris []Fisher) (map[string]float64, error) {
+	labels := make([]string, 0, 8)
+	seen := make(map[string]bool)
+	for _, value := range iris {
+		if !seen[value.Label] {
+			seen[value.Label] = true
+			labels = append(labels, value.Label)
+		}
+	}
+	sort.Strings(labels)
+	rng := rand.New(rand.NewSource(1))
+	similarities := make(map[string]float64, len(labels))
+	for _, label := range labels {
+		class := Filter(iris, func(f Fisher) bool { return f.Label == label })
+		others := Filter(iris, func(f Fisher) bool { return f.Label != label })
+		rng.Shuffle(len(others), func(i, j int) { others[i], others[j] = others[j], others[i] })
+		combined := Filter(append(class, others[:min(len(class), len(others))]...),
+			func(Fisher) bool { return true })
+		similarity, err := ProcessSimilarity(combined, DefaultConfig())
+		if err != nil {
+			return nil, fmt.Errorf("label %s: %w", label, err)
+		}
+		similarities[label] = similarity
+	}
+	return similarities, nil
+}
+
+// Permute returns a copy of the data set with each measure column shuffled independently,
+// which keeps the column distributions and destroys the structure between the columns
+func Permute(iris []Fisher, rng *rand.Rand) []Fisher {
+	permuted := make([]Fisher, len(iris))
+	for i, value := range iris {
+		value.Measures = append([]float64{}, value.Measures...)
+		permuted[i] = value
+	}
+	if len(iris) == 0 {
+		return permuted
+	}
+	for col := range iris[0].Measures {
+		rng.Shuffle(len(permuted), func(i, j int) {
+			permuted[i].Measures[col], permuted[j].Measures[col] = permuted[j].Measures[col], permuted[i].Measures[col]
+		})
+	}
+	return permuted
+}
+
+// PermutationTest computes the two sided empirical p-value of the cosine similarity of the data set against
+// perms column wise permutations of it, the fraction of the permutations at least as far from the null mean
+func PermutationTest(iris []Fisher, perms int, seed int64) (pvalue float64, err error) {
+	if perms < 1 {
+		return 0, errors.New("permutation test requires at least one permutation")
+	}
+	cfg := DefaultConfig()
+	similarity, err := ProcessSimilarity(iris, cfg)
+	if err != nil {
+		return 0, err
+	}
+	rng := rand.New(rand.NewSource(seed))
+	datasets := make([][]Fisher, perms)
+	for i := range datasets {
+		datasets[i] = Permute(iris, rng)
+	}
+	null, err := ProcessBatch(datasets, cfg)
+	if err != nil {
+		return 0, err
+	}
+	mean, count := stat.Mean(null, nil), 0
+	for _, value := range null {
+		if math.Abs(value-mean) >= math.Abs(similarity-mean) {
+			count++
+		}
+	}
+	return float64(count+1) / float64(perms+1), nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2025 The Lemma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestBootstrap(t *testing.T) {
+	iris := Load()
+	sample := Bootstrap(iris, 1)
+	if len(sample) != len(iris) {
+		t.Fatalf("got %d records, expected %d", len(sample), len(iris))
+	}
+	// the records keep their original Index
+	for i, value := range sample {
+		if !reflect.DeepEqual(value, iris[value.Index]) {
+			t.Fatalf("sample %d is not record %d of the data set", i, value.Index)
+		}
+	}
+	if !reflect.DeepEqual(Bootstrap(iris, 1), sample) {
+		t.Fatal("the same seed gave a different sample")
+	}
+	if reflect.DeepEqual(Bootstrap(iris, 2), sample) {
+		t.Fatal("a different seed gave the same sample")
+	}
+}
+
+func TestPerClassSimilarity(t *testing.T) {
+	similarities, err := PerClassSimilarity(Load())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(similarities) != 3 {
+		t.Fatalf("got %d scores, expected one per species", len(similarities))
+	}
+	for _, label := range Inverse {
+		similarity, ok := similarities[label]
+		if !ok {
+			t.Fatalf("no score for %s", label)
+		}
+		if math.IsNaN(similarity) || math.Abs(similarity) > 1 {
+			t.Fatalf("%s score %v, expected a cosine similarity", label, similarity)
+		}
+	}
+}
+
+func TestPermutationTest(t *testing.T) {
+	// the iris structure is more extreme than every permutation, the smallest p-value of 19 permutations
+	pvalue, err := PermutationTest(Load(), 19, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pvalue != .05 {
+		t.Fatalf("p-value %v, expected 1/20", pvalue)
+	}
+	if _, err := PermutationTest(Load(), 0, 1); err == nil {
+		t.Fatal("expected an error without permutations")
+	}
+}
@@ -0,0 +1,310 @@
+// Copyright 2025 The Lemma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat"
+)
+
+// RankNormalize replaces each measure with its percentile rank in [0,1] within its column.
+// Tied values are assigned the average of their ranks.
+func RankNormalize(iris []Fisher) {
+	if len(iris) == 0 {
+		return
+	}
+	n := len(iris)
+	order := make([]int, n)
+	ranks := make([]float64, n)
+	for col := range iris[0].Measures {
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return iris[order[i]].Measures[col] < iris[order[j]].Measures[col]
+		})
+		for i := 0; i < n; {
+			j := i + 1
+			for j < n && iris[order[j]].Measures[col] == iris[order[i]].Measures[col] {
+				j++
+			}
+			rank := float64(i+j-1) / 2
+			for k := i; k < j; k++ {
+				ranks[order[k]] = rank
+			}
+			i = j
+		}
+		for i := range iris {
+			if n > 1 {
+				iris[i].Measures[col] = ranks[i] / float64(n-1)
+			} else {
+				iris[i].Measures[col] = 0
+			}
+		}
+	}
+}
+
+// Policy is the handling of non finite measures
+type Policy int
+
+const (
+	// PolicyNone performs no checks
+	PolicyNone Policy = iota
+	// PolicyError returns an error for the first non finite measure
+	PolicyError
+	// PolicyZero replaces non finite measures with zero
+	PolicyZero
+	// PolicyMean replaces non finite measures with the mean of the finite measures in the column
+	PolicyMean
+)
+
+// Policies maps the names of the policies to the policies
+var Policies = map[string]Policy{
+	"none":  PolicyNone,
+	"error": PolicyError,
+	"zero":  PolicyZero,
+	"mean":  PolicyMean,
+}
+
+// Sanitize checks the measures for NaN and Inf according to the policy.
+// When values are replaced a copy of the data set is returned and the input is left unchanged.
+func Sanitize(iris []Fisher, policy Policy) ([]Fisher, error) {
+	if policy == PolicyNone {
+		return iris, nil
+	}
+	var sanitized []Fisher
+	var means []float64
+	for i, value := range iris {
+		copied := false
+		for ii, measure := range value.Measures {
+			if !math.IsNaN(measure) && !math.IsInf(measure, 0) {
+				continue
+			}
+			switch policy {
+			case PolicyError:
+				return nil, fmt.Errorf("record %d measure %d is %v", value.Index, ii, measure)
+			case PolicyMean:
+				if means == nil {
+					means = finiteMeans(iris)
+				}
+				measure = means[ii]
+			default:
+				measure = 0
+			}
+			if sanitized == nil {
+				sanitized = make([]Fisher, len(iris))
+				copy(sanitized, iris)
+			}
+			if !copied {
+				sanitized[i].Measures = append([]float64{}, value.Measures...)
+				copied = true
+			}
+			sanitized[i].Measures[ii] = measure
+		}
+	}
+	if sanitized == nil {
+		return iris, nil
+	}
+	return sanitized, nil
+}
+
+// finiteMeans computes the mean of the finite measures of each column
+func finiteMeans(iris []Fisher) []float64 {
+	width := 0
+	for _, value := range iris {
+		width = max(width, len(value.Measures))
+	}
+	means, counts := make([]float64, width), make([]int, width)
+	for _, value := range iris {
+		for i, measure := range value.Measures {
+			if !math.IsNaN(measure) && !math.IsInf(measure, 0) {
+				means[i] += measure
+				counts[i]++
+			}
+		}
+	}
+	for i := range means {
+		if counts[i] > 0 {
+			means[i] /= float64(counts[i])
+		}
+	}
+	return means
+}
+
+// SortByLabel sorts the data set by label, records with equal labels keep their order and indexes
+func SortByLabel(iris []Fisher) {
+	sort.SliceStable(iris, func(i, j int) bool {
+		return iris[i].Label < iris[j].Label
+	})
+}
+
+// SortByMeasure sorts the data set by the measure in column col, records with equal measures keep their order and indexes
+func SortByMeasure(iris []Fisher, col int) {
+	sort.SliceStable(iris, func(i, j int) bool {
+		return iris[i].Measures[col] < iris[j].Measures[col]
+	})
+}
+
+// HasTag reports whether the record is tagged with tag
+func (f Fisher) HasTag(tag string) bool {
+	for _, t := range f.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter returns the records matching the predicate with Index reassigned by order
+func Filter(iris []Fisher, pred func(Fisher) bool) []Fisher {
+	filtered := make([]Fisher, 0, len(iris))
+	for _, value := range iris {
+		if pred(value) {
+			value.Index = len(filtered)
+			filtered = append(filtered, value)
+		}
+	}
+	return filtered
+}
+
+// Whiten applies the zca whitening transform W = V·D^(-1/2)·Vᵀ of the measure covariance V·D·Vᵀ to the
+// centered measures in place, so the whitened measures have identity covariance. A small regularizer is
+// added to the eigenvalues so that near zero variance directions are not amplified without bound.
+// The measures are left unchanged if the decomposition fails.
+func Whiten(iris []Fisher) error {
+	const epsilon = 1e-8
+	if len(iris) < 2 {
+		return nil
+	}
+	a := Matrix(iris)
+	n, width := a.Dims()
+	var covariance mat.SymDense
+	stat.CovarianceMatrix(&covariance, a, nil)
+	var eig mat.EigenSym
+	ok := eig.Factorize(&covariance, true)
+	if !ok {
+		return ErrEigenFailed
+	}
+	values := eig.Values(nil)
+	var vectors mat.Dense
+	eig.VectorsTo(&vectors)
+	scaled := mat.NewDense(width, width, nil)
+	scaled.Copy(&vectors)
+	for c, value := range values {
+		scale := 1 / math.Sqrt(math.Max(value, 0)+epsilon)
+		for r := range width {
+			scaled.Set(r, c, scaled.At(r, c)*scale)
+		}
+	}
+	var w mat.Dense
+	w.Mul(scaled, vectors.T())
+	means := make([]float64, width)
+	for c := range means {
+		means[c] = stat.Mean(mat.Col(nil, c, a), nil)
+	}
+	centered := make([]float64, width)
+	for i := range n {
+		for c := range centered {
+			centered[c] = a.At(i, c) - means[c]
+		}
+		whitened := mat.NewVecDense(width, iris[i].Measures)
+		whitened.MulVec(&w, mat.NewVecDense(width, centered))
+	}
+	return nil
+}
+
+// Standardize scales each measure in place to zero mean and unit variance within its column,
+// a constant column is centered to zero
+func Standardize(iris []Fisher) {
+	if len(iris) == 0 {
+		return
+	}
+	column := make([]float64, len(iris))
+	for col := range iris[0].Measures {
+		for i, value := range iris {
+			column[i] = value.Measures[col]
+		}
+		mean, std := stat.MeanStdDev(column, nil)
+		for i := range iris {
+			iris[i].Measures[col] -= mean
+			if std > 0 {
+				iris[i].Measures[col] /= std
+			}
+		}
+	}
+}
+
+// RunningStats is an online standardizer that computes the running mean and variance of each
+// measure with welford's algorithm
+type RunningStats struct {
+	// Count is the number of pushed records
+	Count int
+	// Mean is the running mean of each measure
+	Mean []float64
+	// M2 is the running sum of the squared differences from the mean of each measure
+	M2 []float64
+}
+
+// Push adds the measures of a record to the running statistics
+func (r *RunningStats) Push(x []float64) {
+	if r.Mean == nil {
+		r.Mean, r.M2 = make([]float64, len(x)), make([]float64, len(x))
+	}
+	r.Count++
+	for i, value := range x {
+		delta := value - r.Mean[i]
+		r.Mean[i] += delta / float64(r.Count)
+		r.M2[i] += delta * (value - r.Mean[i])
+	}
+}
+
+// StdDev computes the sample standard deviation of each measure as used by Standardize
+func (r *RunningStats) StdDev() []float64 {
+	std := make([]float64, len(r.M2))
+	if r.Count < 2 {
+		return std
+	}
+	for i, m2 := range r.M2 {
+		std[i] = math.Sqrt(m2 / float64(r.Count-1))
+	}
+	return std
+}
+
+// Transform standardizes the measures in place with the running mean and standard deviation,
+// a measure with zero standard deviation is only centered
+func (r *RunningStats) Transform(x []float64) {
+	for i := range x {
+		x[i] -= r.Mean[i]
+		if r.Count > 1 && r.M2[i] > 0 {
+			x[i] /= math.Sqrt(r.M2[i] / float64(r.Count-1))
+		}
+	}
+}
+
+// Summarize computes the min, max, mean, and sample standard deviation of each measure
+func Summarize(iris []Fisher) [][4]float64 {
+	if len(iris) == 0 {
+		return nil
+	}
+	var stats RunningStats
+	summary := make([][4]float64, len(iris[0].Measures))
+	for i := range summary {
+		summary[i][0], summary[i][1] = math.Inf(1), math.Inf(-1)
+	}
+	for _, value := range iris {
+		stats.Push(value.Measures)
+		for i, measure := range value.Measures {
+			summary[i][0], summary[i][1] = math.Min(summary[i][0], measure), math.Max(summary[i][1], measure)
+		}
+	}
+	for i, std := range stats.StdDev() {
+		summary[i][2], summary[i][3] = stats.Mean[i], std
+	}
+	return summary
+}
@@ -0,0 +1,183 @@
+// Copyright 2025 The Lemma Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat"
+)
+
+func TestWhiten(t *testing.T) {
+	iris := Load()
+	if err := Whiten(iris); err != nil {
+		t.Fatal(err)
+	}
+	var covariance mat.SymDense
+	stat.CovarianceMatrix(&covariance, Matrix(iris), nil)
+	n, _ := covariance.Dims()
+	for i := range n {
+		for j := range n {
+			want := 0.0
+			if i == j {
+				want = 1
+			}
+			if math.Abs(covariance.At(i, j)-want) > 1e-6 {
+				t.Fatalf("covariance (%d, %d) is %v, expected %v", i, j, covariance.At(i, j), want)
+			}
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	iris := []Fisher{
+		{Measures: []float64{1, math.NaN()}, Index: 0},
+		{Measures: []float64{2, 4}, Index: 1},
+		{Measures: []float64{3, 8}, Index: 2},
+	}
+	if _, err := Sanitize(iris, PolicyError); err == nil {
+		t.Fatal("expected an error for the NaN measure")
+	}
+	for _, test := range []struct {
+		policy Policy
+		want   float64
+	}{
+		{PolicyZero, 0},
+		{PolicyMean, 6},
+	} {
+		sanitized, err := Sanitize(iris, test.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value := sanitized[0].Measures[1]; value != test.want {
+			t.Fatalf("policy %d replaced the NaN with %v, expected %v", test.policy, value, test.want)
+		}
+		if !math.IsNaN(iris[0].Measures[1]) {
+			t.Fatalf("policy %d modified the input", test.policy)
+		}
+	}
+	// without a policy the non finite measure fails validation instead of reaching the decomposition
+	cfg := DefaultConfig()
+	cfg.NonFinite = PolicyNone
+	if _, err := ProcessSimilarity(iris, cfg); err == nil {
+		t.Fatal("expected the NaN measure to fail validation")
+	}
+	iris[0].Measures[1] = math.Inf(1)
+	if _, err := ProcessSimilarity(iris, cfg); err == nil {
+		t.Fatal("expected the Inf measure to fail validation")
+	}
+}
+
+func TestRankNormalize(t *testing.T) {
+	columns := [][]float64{
+		{10, 30, 20, 40, 50},
+		{1, 2, 2, 3, 2},
+	}
+	iris := make([]Fisher, 5)
+	for i := range iris {
+		iris[i].Measures = []float64{columns[0][i], columns[1][i]}
+	}
+	RankNormalize(iris)
+	// distinct values are spread uniformly over [0, 1] and the tied 2s share the mean of ranks 1, 2, and 3
+	want := [][]float64{
+		{0, .5, .25, .75, 1},
+		{0, .5, .5, 1, .5},
+	}
+	for i, value := range iris {
+		for c := range want {
+			if value.Measures[c] != want[c][i] {
+				t.Fatalf("record %d column %d rank %v, expected %v", i, c, value.Measures[c], want[c][i])
+			}
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	iris := []Fisher{
+		{Label: "b", Measures: []float64{2}, Index: 0},
+		{Label: "a", Measures: []float64{1}, Index: 1},
+		{Label: "b", Measures: []float64{1}, Index: 2},
+		{Label: "a", Measures: []float64{2}, Index: 3},
+		{Label: "a", Measures: []float64{1}, Index: 4},
+	}
+	SortByLabel(iris)
+	// equal labels keep their order and the records keep their indexes
+	for i, index := range []int{1, 3, 4, 0, 2} {
+		if iris[i].Index != index {
+			t.Fatalf("position %d has index %d, expected %d", i, iris[i].Index, index)
+		}
+	}
+	SortByMeasure(iris, 0)
+	for i, index := range []int{1, 4, 2, 3, 0} {
+		if iris[i].Index != index {
+			t.Fatalf("position %d has index %d, expected %d", i, iris[i].Index, index)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	filtered := Filter(Load(), func(f Fisher) bool {
+		return f.Label == "Iris-setosa" || f.Label == "Iris-versicolor"
+	})
+	if len(filtered) != 100 {
+		t.Fatalf("got %d records, expected 100", len(filtered))
+	}
+	for i, value := range filtered {
+		if value.Index != i {
+			t.Fatalf("record %d has index %d, expected %d", i, value.Index, i)
+		}
+		if value.Label == "Iris-virginica" {
+			t.Fatalf("record %d is %s", i, value.Label)
+		}
+	}
+}
+
+func TestRunningStats(t *testing.T) {
+	batch, online := Load(), Load()
+	Standardize(batch)
+	var stats RunningStats
+	for _, value := range online {
+		stats.Push(value.Measures)
+	}
+	if stats.Count != len(online) {
+		t.Fatalf("got count %d, expected %d", stats.Count, len(online))
+	}
+	for i, value := range online {
+		stats.Transform(value.Measures)
+		for j, measure := range value.Measures {
+			if math.Abs(measure-batch[i].Measures[j]) > 1e-9 {
+				t.Fatalf("record %d measure %d is %v, expected the batch standardized %v", i, j, measure, batch[i].Measures[j])
+			}
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	iris := []Fisher{
+		{Measures: []float64{1, 10}},
+		{Measures: []float64{3, 20}},
+		{Measures: []float64{5, 30}},
+	}
+	want := [][4]float64{
+		{1, 5, 3, 2},
+		{10, 30, 20, 10},
+	}
+	summary := Summarize(iris)
+	if len(summary) != len(want) {
+		t.Fatalf("got %d columns, expected %d", len(summary), len(want))
+	}
+	for i, column := range want {
+		for j, value := range column {
+			if math.Abs(summary[i][j]-value) > 1e-12 {
+				t.Fatalf("column %d got %v, expected %v", i, summary[i], column)
+			}
+		}
+	}
+	if summary := Summarize(nil); summary != nil {
+		t.Fatalf("got %v for no records, expected nil", summary)
+	}
+}